@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/helpers"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"github.com/Sunpacker/go-booking-app/internal/repository/dbrepo"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+)
+
+const demoAdminEmail = "admin@example.com"
+
+// demoRepo returns an in-memory repository holding the rooms of the seed migrations and an administrator.
+// The administrator's password is new on every start and logged, as nothing else could tell it.
+func demoRepo(app *config.AppConfig) (repository.DatabaseRepo, error) {
+	password, _, err := helpers.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := dbrepo.NewMemoryRepo(app, dbrepo.MemoryData{
+		Rooms: []models.Room{
+			{ID: 1, RoomName: "General's Quarters", NightlyRate: 9900},
+			{ID: 2, RoomName: "Major's Suite", NightlyRate: 14900},
+		},
+		Users: []models.User{
+			{
+				FirstName:   "Demo",
+				LastName:    "Admin",
+				Email:       demoAdminEmail,
+				Password:    string(hashedPassword),
+				AccessLevel: models.AccessLevelAdmin,
+				Active:      true,
+			},
+		},
+	})
+
+	app.Logger.Warn("running in demo mode, all data is lost on exit",
+		slog.String("email", demoAdminEmail), slog.String("password", password))
+
+	return repo, nil
+}
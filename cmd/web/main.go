@@ -1,105 +1,202 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/gob"
 	"fmt"
+	assets "github.com/Sunpacker/go-booking-app"
 	"github.com/Sunpacker/go-booking-app/internal/config"
 	"github.com/Sunpacker/go-booking-app/internal/driver"
-	"github.com/Sunpacker/go-booking-app/internal/handlers"
-	"github.com/Sunpacker/go-booking-app/internal/helpers"
+	"github.com/Sunpacker/go-booking-app/internal/ical"
+	"github.com/Sunpacker/go-booking-app/internal/logging"
 	"github.com/Sunpacker/go-booking-app/internal/models"
-	"github.com/Sunpacker/go-booking-app/internal/render"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"github.com/Sunpacker/go-booking-app/internal/repository/dbrepo"
+	"github.com/Sunpacker/go-booking-app/internal/sessionstore"
+	"github.com/Sunpacker/go-booking-app/internal/tracing"
 	"github.com/alexedwards/scs/v2"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 )
 
 const PORT = ":8080"
 
-var app config.AppConfig
-var session *scs.SessionManager
-
 func main() {
-	db, err := run()
+	srv, db, err := run()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer func(SQL *sql.DB) {
-		err := SQL.Close()
+	// packages without the app config, and the standard log package, log through it too
+	slog.SetDefault(srv.app.Logger)
+
+	defer func(db *driver.DB) {
+		// demo mode runs without a database
+		if db == nil {
+			return
+		}
+		err := db.SQL.Close()
 		if err != nil {
 			log.Fatal(err)
 		}
-	}(db.SQL)
+	}(db)
+
+	stopTracing, err := tracing.Setup(context.Background(), srv.app.TraceExporter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		_ = stopTracing(context.Background())
+	}()
+
+	ctx, stopSync := context.WithCancel(context.Background())
+	defer stopSync()
+	go ical.NewSyncer(srv.app, srv.handlers.DB).Run(ctx, srv.app.ICalSyncInterval)
 
 	serve := &http.Server{
 		Addr:    PORT,
-		Handler: routes(),
+		Handler: srv.routes(),
 	}
 
-	fmt.Printf("Starting application on port %s\n", PORT)
+	if srv.app.MetricsToken != "" {
+		go func() {
+			metricsServer := &http.Server{
+				Addr:    srv.app.MetricsAddr,
+				Handler: srv.metricsRoutes(),
+			}
+			srv.app.Logger.Info("serving metrics", slog.String("addr", srv.app.MetricsAddr))
+			err := metricsServer.ListenAndServe()
+			srv.app.Logger.Error("metrics listener stopped", slog.String("error", err.Error()))
+		}()
+	} else {
+		srv.app.Logger.Warn("METRICS_TOKEN is not set, metrics are not served")
+	}
+
+	srv.app.Logger.Info("starting application", slog.String("port", PORT))
 	err = serve.ListenAndServe()
 	log.Fatal(err)
 }
 
-func run() (*driver.DB, error) {
+// run configures the app and sets up its server, leaving process-wide state such as the default
+// logger to main. The database is returned for closing, and is nil in demo mode.
+func run() (*server, *driver.DB, error) {
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Reservation{})
 	gob.Register(models.Restriction{})
 	gob.Register(models.RoomRestriction{})
 
+	app := &config.AppConfig{}
 	app.IsProd = false
 	app.UseCache = app.IsProd
-	app.InfoLog = log.New(os.Stdout, "[INFO]\t", log.Ldate|log.Ltime)
-	app.ErrorLog = log.New(os.Stdout, "[ERROR]\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// LIVE_ASSETS reads templates and static files from disk on every request, for development
+	app.LiveAssets, _ = strconv.ParseBool(os.Getenv("LIVE_ASSETS"))
+	app.Logger = logging.New(os.Stdout, app.IsProd, slog.LevelInfo)
+	app.ICalSyncInterval = 15 * time.Minute
+	app.QueryTimeout = 3 * time.Second
+	// the standard OpenTelemetry variable; OTEL_EXPORTER_OTLP_ENDPOINT sets where otlp sends to
+	app.TraceExporter = os.Getenv("OTEL_TRACES_EXPORTER")
+	// SESSION_STORE is "postgres" or "memory"; demo mode always keeps sessions in memory
+	app.SessionStore = os.Getenv("SESSION_STORE")
+	if app.SessionStore == "" {
+		app.SessionStore = "postgres"
+	}
+	app.SessionCleanupInterval = 5 * time.Minute
+	app.BaseURL = "http://localhost" + PORT
+	app.MailFrom = "booking@localhost"
+	app.SMTPAddr = "localhost:1025"
+	app.MailChan = make(chan models.MailData, 100)
+	// REQUIRE_MANAGER_2FA sends managers and admins without two-factor login to its setup before the admin pages
+	app.RequireManagerTwoFactor, _ = strconv.ParseBool(os.Getenv("REQUIRE_MANAGER_2FA"))
+	// metrics get a listener of their own, only reachable from this host unless METRICS_ADDR says otherwise
+	app.MetricsAddr = os.Getenv("METRICS_ADDR")
+	if app.MetricsAddr == "" {
+		app.MetricsAddr = "localhost:9090"
+	}
+	app.MetricsToken = os.Getenv("METRICS_TOKEN")
+	app.DemoMode, _ = strconv.ParseBool(os.Getenv("DEMO_MODE"))
+
+	var db *driver.DB
+	var repo repository.DatabaseRepo
+	var err error
+	if app.DemoMode {
+		app.SessionStore = "memory"
+		repo, err = demoRepo(app)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		db, err = driver.ConnectSQL("host=localhost port=5432 dbname=booking-app user=postgres password=root")
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot connect to database: %w", err)
+		}
+		repo = dbrepo.NewPostgresRepo(db.SQL, app)
+	}
 
-	db, err := driver.ConnectSQL("host=localhost port=5432 dbname=booking-app user=postgres password=root")
+	session, err := newSession(app, db)
 	if err != nil {
-		log.Fatal("cannot connect to database, dying...")
+		return nil, nil, err
 	}
-
-	initSession()
-	initHandlers(db)
-	err = initPages()
+	err = initAssets(app)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv, err := newServer(app, session, repo)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if db != nil {
+		err = srv.metrics.RegisterDB(db)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	initHelpers()
+	listenForMail(app)
 
-	return db, nil
+	return srv, db, nil
 }
 
-func initSession() {
-	session = scs.New()
+// newSession creates the session manager of app, keeping sessions where app.SessionStore says
+func newSession(app *config.AppConfig, db *driver.DB) (*scs.SessionManager, error) {
+	session := scs.New()
 	session.Lifetime = 24 * time.Hour
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Persist = true
 	session.Cookie.Secure = app.IsProd
 
-	app.Session = session
-}
+	switch app.SessionStore {
+	case "postgres":
+		session.Store = sessionstore.NewPostgresStore(db.SQL, app.SessionCleanupInterval)
+	case "memory", "":
+		// scs keeps sessions in memory by default
+	default:
+		return nil, fmt.Errorf("unknown session store '%s'", app.SessionStore)
+	}
 
-func initHandlers(db *driver.DB) {
-	repo := handlers.CreateNewRepo(&app, db)
-	handlers.NewHandlers(repo)
+	return session, nil
 }
 
-func initPages() error {
-	templateCache, err := render.CreateTemplateCache()
+func initAssets(app *config.AppConfig) error {
+	if app.LiveAssets {
+		app.TemplateFS = os.DirFS("./templates")
+		app.StaticFS = os.DirFS("./static")
+		return nil
+	}
+
+	templates, err := fs.Sub(assets.FS, "templates")
+	if err != nil {
+		return err
+	}
+	static, err := fs.Sub(assets.FS, "static")
 	if err != nil {
-		log.Fatal("cannot create template cache:", err)
 		return err
 	}
 
-	app.TemplateCache = templateCache
-	render.NewRenderer(&app)
-
+	app.TemplateFS = templates
+	app.StaticFS = static
 	return nil
 }
-
-func initHelpers() {
-	helpers.NewHelpers(&app)
-}
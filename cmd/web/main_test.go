@@ -1,10 +1,46 @@
 package main
 
-import "testing"
+import (
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"testing"
+)
 
 func TestRun(t *testing.T) {
-	_, err := run()
-	if err != nil {
-		t.Error("failed to execute 'run'")
+	t.Setenv("DEMO_MODE", "true")
+
+	// run keeps its state on the server, so it can set up a second one in the same process
+	for i := 0; i < 2; i++ {
+		srv, db, err := run()
+		if err != nil {
+			t.Fatalf("failed to execute 'run': %v", err)
+		}
+		if db != nil || srv.app.SessionStore != "memory" {
+			t.Error("demo mode did not run without a database")
+		}
+	}
+}
+
+func TestRun_RequireManagerTwoFactor(t *testing.T) {
+	t.Setenv("DEMO_MODE", "true")
+
+	for value, expected := range map[string]bool{"": false, "false": false, "true": true, "1": true} {
+		t.Setenv("REQUIRE_MANAGER_2FA", value)
+
+		srv, _, err := run()
+		if err != nil {
+			t.Fatalf("failed to execute 'run': %v", err)
+		}
+		if srv.app.RequireManagerTwoFactor != expected {
+			t.Errorf("REQUIRE_MANAGER_2FA '%s': expected %v", value, expected)
+		}
+	}
+}
+
+func TestNewSession(t *testing.T) {
+	for store, expectedError := range map[string]bool{"memory": false, "": false, "redis": true} {
+		_, err := newSession(&config.AppConfig{SessionStore: store}, nil)
+		if (err != nil) != expectedError {
+			t.Errorf("session store '%s': expected error %v, got %v", store, expectedError, err)
+		}
 	}
 }
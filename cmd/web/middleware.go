@@ -1,34 +1,148 @@
 package main
 
 import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
 	"github.com/Sunpacker/go-booking-app/internal/helpers"
+	"github.com/Sunpacker/go-booking-app/internal/i18n"
+	"github.com/Sunpacker/go-booking-app/internal/logging"
+	"github.com/go-chi/chi/middleware"
 	"github.com/justinas/nosurf"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // NoSurf adds CSRF protection to all POST requests
-func NoSurf(next http.Handler) http.Handler {
+func (s *server) NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 
 	csrfHandler.SetBaseCookie(http.Cookie{
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
 		HttpOnly: true,
-		Secure:   app.IsProd,
+		Secure:   s.app.IsProd,
 	})
 
 	return csrfHandler
 }
 
+// LogRequests logs every request once it is answered, with the ID given by middleware.RequestID.
+// Attributes added for the request, like the user from LoadUser, are in the line too, and in
+// everything else logged with the request's context.
+func (s *server) LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ctx := logging.NewContext(r.Context())
+		if id := middleware.GetReqID(ctx); id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
+			logging.AddAttrs(ctx, slog.String("request_id", id))
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		s.app.Logger.LogAttrs(ctx, level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+// RequireMetricsToken refuses requests that do not send app.MetricsToken as their bearer token
+func (s *server) RequireMetricsToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.app.MetricsToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.app.MetricsToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // SessionLoad loads and saves the session on every request
-func SessionLoad(next http.Handler) http.Handler {
-	return session.LoadAndSave(next)
+func (s *server) SessionLoad(next http.Handler) http.Handler {
+	return s.session.LoadAndSave(next)
+}
+
+// Locale picks the language of the request: the one chosen with the language switch,
+// otherwise the best match for the browser's Accept-Language header
+func (s *server) Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := s.session.GetString(r.Context(), "locale")
+		if !i18n.Supported(locale) {
+			locale = i18n.Match(r.Header.Get("Accept-Language"))
+		}
+
+		w.Header().Set("Content-Language", locale)
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
+
+// LoadUser puts the logged-in user into the request context, so it is read from the database
+// once per request. Sessions of deactivated users, and those ended by a password change, are logged out.
+func (s *server) LoadUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := s.session.GetInt(r.Context(), "user_id")
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := s.handlers.DB.GetUserByID(r.Context(), id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, r, s.app.Logger, err)
+			return
+		}
+
+		var reason string
+		switch {
+		case err != nil:
+			reason = "your account no longer exists"
+		case !user.Active:
+			reason = "your account has been deactivated"
+		case user.SessionVersion != s.session.GetInt(r.Context(), "session_version"):
+			// a password change bumps the user's session version, which ends all sessions started before it
+			reason = "your session has expired, log in again"
+		}
+
+		if reason != "" {
+			_ = s.session.Destroy(r.Context())
+			_ = s.session.RenewToken(r.Context())
+			s.session.Put(r.Context(), "error", reason)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logging.AddAttrs(r.Context(), slog.Int("user_id", user.ID))
+		next.ServeHTTP(w, r.WithContext(helpers.WithUser(r.Context(), user)))
+	})
 }
 
-func Auth(next http.Handler) http.Handler {
+func (s *server) Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !helpers.IsAuthenticated(r) {
-			session.Put(r.Context(), "error", "log in first!")
+			if !s.session.Exists(r.Context(), "error") {
+				s.session.Put(r.Context(), "error", "log in first!")
+			}
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
@@ -36,3 +150,31 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireTwoFactor sends managers without two-factor login to its setup when the app requires it
+func (s *server) RequireTwoFactor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := helpers.CurrentUser(r)
+		if s.app.RequireManagerTwoFactor && user.IsManager() && !user.TOTPEnabled {
+			s.session.Put(r.Context(), "warning", "set up two-factor login to continue")
+			http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin limits a route to administrators
+func (s *server) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := helpers.CurrentUser(r)
+		if !user.IsAdmin() {
+			s.session.Put(r.Context(), "error", "only administrators can do that")
+			http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
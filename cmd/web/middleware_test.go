@@ -1,15 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/Sunpacker/go-booking-app/internal/helpers"
+	"github.com/Sunpacker/go-booking-app/internal/logging"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/go-chi/chi/middleware"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestNoSurf(t *testing.T) {
 	var skeletonHandler SkeletonHandler
 
-	handler := NoSurf(&skeletonHandler)
+	handler := newTestServer(t).NoSurf(&skeletonHandler)
 
 	switch typeReceived := handler.(type) {
 	case http.Handler:
@@ -21,7 +30,7 @@ func TestNoSurf(t *testing.T) {
 func TestSessionLoad(t *testing.T) {
 	var skeletonHandler SkeletonHandler
 
-	handler := SessionLoad(&skeletonHandler)
+	handler := newTestServer(t).SessionLoad(&skeletonHandler)
 
 	switch typeReceived := handler.(type) {
 	case http.Handler:
@@ -29,3 +38,112 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", typeReceived))
 	}
 }
+
+// loadUserTests is the data for the LoadUser middleware test. The users are inserted by the test:
+// 1 is active, 2 deactivated and 3 changed their password, which ends sessions of version 0.
+var loadUserTests = []struct {
+	name           string
+	userID         int
+	sessionVersion int
+	expectedUserID int
+	expectedError  string
+}{
+	{"visitor", 0, 0, 0, ""},
+	{"logged-in", 1, 0, 1, ""},
+	{"deactivated", 2, 0, 0, "your account has been deactivated"},
+	{"session-version-mismatch", 3, 0, 0, "your session has expired, log in again"},
+	{"current-session-version", 3, 1, 3, ""},
+	{"deleted", 4, 0, 0, "your account no longer exists"},
+}
+
+func TestLoadUser(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+	for _, email := range []string{"active@here.com", "deactivated@here.com", "changed@here.com"} {
+		_, err := srv.handlers.DB.InsertUser(ctx, models.User{FirstName: "Jane", LastName: "Smith", Email: email, AccessLevel: models.AccessLevelStaff})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := srv.handlers.DB.SetUserActive(ctx, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = srv.handlers.DB.UpdatePassword(ctx, 3, "new hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range loadUserTests {
+		sessionCtx, err := srv.session.Load(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.userID > 0 {
+			srv.session.Put(sessionCtx, "user_id", e.userID)
+			srv.session.Put(sessionCtx, "session_version", e.sessionVersion)
+		}
+
+		var user models.User
+		handler := srv.LoadUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ = helpers.CurrentUser(r)
+		}))
+		req := httptest.NewRequest("GET", "/", nil).WithContext(sessionCtx)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if user.ID != e.expectedUserID {
+			t.Errorf("%s: expected user %d in the request context, got %d", e.name, e.expectedUserID, user.ID)
+		}
+		if loggedIn := srv.session.Exists(sessionCtx, "user_id"); loggedIn != (e.expectedUserID > 0) {
+			t.Errorf("%s: expected logged in to be %t, got %t", e.name, e.expectedUserID > 0, loggedIn)
+		}
+		if msg := srv.session.GetString(sessionCtx, "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error '%s', got '%s'", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	var skeletonHandler SkeletonHandler
+
+	handler := newTestServer(t).Locale(&skeletonHandler)
+
+	switch typeReceived := handler.(type) {
+	case http.Handler:
+	default:
+		t.Error(fmt.Sprintf("type is not http.Handler, but is %T", typeReceived))
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var out bytes.Buffer
+	srv := newTestServer(t)
+	srv.app.Logger = logging.New(&out, true, slog.LevelInfo)
+
+	handler := middleware.RequestID(srv.LogRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// as LoadUser does for logged-in users
+		logging.AddAttrs(r.Context(), slog.Int("user_id", 7))
+		w.WriteHeader(http.StatusTeapot)
+	})))
+
+	r := httptest.NewRequest("GET", "/admin/dashboard", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	var record map[string]interface{}
+	err := json.Unmarshal(out.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("expected one JSON line, got %q", out.String())
+	}
+
+	if record["msg"] != "request" || record["method"] != "GET" || record["path"] != "/admin/dashboard" ||
+		record["status"] != float64(http.StatusTeapot) || record["user_id"] != 7.0 {
+		t.Errorf("wrong request log: %v", record)
+	}
+	if _, ok := record["duration"]; !ok {
+		t.Error("duration not logged")
+	}
+	if id, _ := record["request_id"].(string); id == "" || rr.Header().Get("X-Request-Id") != id {
+		t.Errorf("request id not logged or not sent back: %v", record["request_id"])
+	}
+}
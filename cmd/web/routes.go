@@ -1,66 +1,134 @@
 package main
 
 import (
-	"github.com/Sunpacker/go-booking-app/internal/handlers"
+	"github.com/Sunpacker/go-booking-app/internal/tracing"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"net/http"
 )
 
-func routes() http.Handler {
+// routes builds the router of the server
+func (s *server) routes() http.Handler {
 	mux := chi.NewRouter()
 
-	initMiddlewares(mux)
-	initStaticFilesDir(mux)
-	initPageRoutes(mux)
+	// set before the middlewares, which already wrap these handlers, and before any sub-router
+	// is mounted, so those inherit them
+	mux.NotFound(s.handlers.NotFound)
+	mux.MethodNotAllowed(s.handlers.MethodNotAllowed)
+
+	s.initMiddlewares(mux)
+	s.initStaticFilesDir(mux)
+	s.initPageRoutes(mux)
+
+	return mux
+}
+
+// metricsRoutes builds the router of the internal metrics listener. Scrapes skip the session
+// and user middlewares of the site and need the bearer token of app.MetricsToken.
+func (s *server) metricsRoutes() http.Handler {
+	mux := chi.NewRouter()
+
+	mux.Use(middleware.Recoverer)
+	mux.Use(s.RequireMetricsToken)
+	mux.Handle("/metrics", s.metrics.Handler())
 
 	return mux
 }
 
-func initMiddlewares(mux *chi.Mux) {
+func (s *server) initMiddlewares(mux *chi.Mux) {
+	mux.Use(middleware.RequestID)
+	// outside of Recoverer, so requests ending in a panic are logged with their 500
+	mux.Use(s.LogRequests)
+	// after LogRequests, which then logs the trace ID too
+	mux.Use(tracing.Middleware)
+	mux.Use(s.metrics.Middleware)
 	mux.Use(middleware.Recoverer)
-	mux.Use(NoSurf)
-	mux.Use(SessionLoad)
+	mux.Use(s.NoSurf)
+	mux.Use(s.SessionLoad)
+	mux.Use(s.Locale)
+	mux.Use(s.LoadUser)
 }
 
-func initStaticFilesDir(mux *chi.Mux) {
-	fileServer := http.FileServer(http.Dir("./static/"))
+func (s *server) initStaticFilesDir(mux *chi.Mux) {
+	fileServer := http.FileServer(http.FS(s.app.StaticFS))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 }
 
-func initPageRoutes(mux *chi.Mux) {
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
-	mux.Get("/contact", handlers.Repo.Contact)
+func (s *server) initPageRoutes(mux *chi.Mux) {
+	mux.Get("/", s.handlers.Home)
+	mux.Get("/about", s.handlers.About)
+	mux.Get("/generals-quarters", s.handlers.Generals)
+	mux.Get("/majors-suite", s.handlers.Majors)
+	mux.Get("/contact", s.handlers.Contact)
+	mux.Post("/locale", s.handlers.PostLocale)
 
-	mux.Get("/search-availability", handlers.Repo.Availability)
-	mux.Post("/search-availability", handlers.Repo.PostAvailability)
-	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
-	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
-	mux.Get("/book-room", handlers.Repo.BookRoom)
+	mux.Get("/search-availability", s.handlers.Availability)
+	mux.Post("/search-availability", s.handlers.PostAvailability)
+	mux.Get("/choose-room/{id}", s.handlers.ChooseRoom)
+	mux.Get("/book-room", s.handlers.BookRoom)
 
-	mux.Get("/make-reservation", handlers.Repo.Reservation)
-	mux.Post("/make-reservation", handlers.Repo.PostReservation)
-	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+	mux.Get("/make-reservation", s.handlers.Reservation)
+	mux.Post("/make-reservation", s.handlers.PostReservation)
+	mux.Get("/reservation-summary", s.handlers.ReservationSummary)
 
-	mux.Get("/user/login", handlers.Repo.ShowLogin)
-	mux.Post("/user/login", handlers.Repo.Login)
-	mux.Get("/user/logout", handlers.Repo.Logout)
+	mux.Get("/user/login", s.handlers.ShowLogin)
+	mux.Post("/user/login", s.handlers.Login)
+	mux.Get("/user/login/two-factor", s.handlers.ShowTwoFactorLogin)
+	mux.Post("/user/login/two-factor", s.handlers.PostTwoFactorLogin)
+	mux.Get("/user/logout", s.handlers.Logout)
+	mux.Get("/user/forgot-password", s.handlers.ShowForgotPassword)
+	mux.Post("/user/forgot-password", s.handlers.PostForgotPassword)
+	mux.Get("/user/reset-password", s.handlers.ShowResetPassword)
+	mux.Post("/user/reset-password", s.handlers.PostResetPassword)
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(s.Auth)
+
+		mux.Get("/user/profile", s.handlers.ShowProfile)
+		mux.Post("/user/profile", s.handlers.PostProfile)
+		mux.Get("/user/password", s.handlers.ShowChangePassword)
+		mux.Post("/user/password", s.handlers.PostChangePassword)
+
+		mux.Get("/user/two-factor", s.handlers.ShowTwoFactor)
+		mux.Post("/user/two-factor", s.handlers.PostTwoFactor)
+		mux.Post("/user/two-factor/disable", s.handlers.PostDisableTwoFactor)
+	})
 
 	mux.Route("/admin", func(mux chi.Router) {
-		mux.Use(Auth)
+		mux.Use(s.Auth)
+		mux.Use(s.RequireTwoFactor)
+
+		mux.Get("/dashboard", s.handlers.AdminDashboard)
+		mux.Get("/search", s.handlers.AdminSearch)
+
+		mux.Get("/reservations-new", s.handlers.AdminNewReservations)
+		mux.Get("/reservations-all", s.handlers.AdminAllReservations)
+		mux.Get("/reservations-export", s.handlers.AdminExportReservations)
+		mux.Get("/reservation-calendar", s.handlers.AdminReservationsCalendar)
+
+		mux.Get("/process-reservation/{src}/{id}", s.handlers.AdminProcessReservation)
+		mux.Get("/reservations/{src}/{id}", s.handlers.AdminShowReservation)
+		mux.Post("/reservations/{src}/{id}", s.handlers.AdminPostReservation)
+		mux.Get("/delete-reservation/{src}/{id}", s.handlers.AdminDeleteReservation)
+
+		mux.Get("/ical-feeds", s.handlers.AdminICalFeeds)
+		mux.Post("/ical-feeds", s.handlers.AdminPostICalFeed)
+		mux.Get("/sync-ical-feed/{id}", s.handlers.AdminSyncICalFeed)
+		mux.Get("/delete-ical-feed/{id}", s.handlers.AdminDeleteICalFeed)
 
-		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+		mux.Get("/login-activity", s.handlers.AdminLoginActivity)
+		mux.Post("/unlock-user/{id}", s.handlers.AdminUnlockUser)
 
-		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
-		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
-		mux.Get("/reservation-calendar", handlers.Repo.AdminReservationsCalendar)
+		mux.Route("/users", func(mux chi.Router) {
+			mux.Use(s.RequireAdmin)
 
-		mux.Get("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
-		mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostReservation)
-		mux.Get("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+			mux.Get("/", s.handlers.AdminUsers)
+			mux.Get("/invite", s.handlers.AdminInviteUser)
+			mux.Post("/invite", s.handlers.AdminPostInviteUser)
+			mux.Get("/{id}", s.handlers.AdminShowUser)
+			mux.Post("/{id}", s.handlers.AdminPostUser)
+			mux.Post("/{id}/deactivate", s.handlers.AdminDeactivateUser)
+			mux.Post("/{id}/activate", s.handlers.AdminActivateUser)
+		})
 	})
 }
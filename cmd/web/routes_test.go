@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/Sunpacker/go-booking-app/internal/models"
 	"github.com/go-chi/chi"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRoutes(t *testing.T) {
-	mux := routes()
+	mux := newTestServer(t).routes()
 
 	switch typeReceived := mux.(type) {
 	case *chi.Mux:
@@ -15,3 +23,197 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not *chi.Mux, but is %T", typeReceived))
 	}
 }
+
+// methodNotAllowedTests is the data for the wrong-method test
+var methodNotAllowedTests = []struct {
+	name   string
+	method string
+	url    string
+}{
+	{"delete-home", "DELETE", "/"},
+	{"put-about", "PUT", "/about"},
+	{"patch-contact", "PATCH", "/contact"},
+}
+
+var csrfTokenRegexp = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// csrfToken takes the CSRF token from a form on page and the cookies to send it with, like a browser does.
+// Without them NoSurf answers 400 to unsafe methods before the request is routed.
+func csrfToken(t *testing.T, mux http.Handler, page string, cookies ...*http.Cookie) (string, []*http.Cookie) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", page, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	match := csrfTokenRegexp.FindStringSubmatch(rr.Body.String())
+	if match == nil {
+		t.Fatalf("no CSRF token on %s", page)
+	}
+	return html.UnescapeString(match[1]), append(cookies, rr.Result().Cookies()...)
+}
+
+// newFormRequest returns a request carrying token and cookies
+func newFormRequest(method, url, token string, cookies []*http.Cookie) *http.Request {
+	req := httptest.NewRequest(method, url, nil)
+	req.Header.Set("X-CSRF-Token", token)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestRoutes_MethodNotAllowed(t *testing.T) {
+	mux := newTestServer(t).routes()
+	token, cookies := csrfToken(t, mux, "/user/login")
+
+	for _, e := range methodNotAllowedTests {
+		req := newFormRequest(e.method, e.url, token, cookies)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusMethodNotAllowed)
+		}
+		// the styled error page, not chi's plain text answer
+		body := rr.Body.String()
+		if !strings.Contains(body, "<html") || !strings.Contains(body, "This page cannot be requested this way.") {
+			t.Errorf("%s did not render the error page: %s", e.name, body)
+		}
+	}
+}
+
+// loginAdmin adds an administrator and a staff member to the repository of srv, and returns the session
+// cookie of the administrator
+func loginAdmin(t *testing.T, srv *server) *http.Cookie {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, user := range []models.User{
+		{FirstName: "Admin", LastName: "User", Email: "admin@here.com", AccessLevel: models.AccessLevelAdmin},
+		{FirstName: "Staff", LastName: "User", Email: "staff@here.com", AccessLevel: models.AccessLevelStaff},
+	} {
+		_, err := srv.handlers.DB.InsertUser(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessionCtx, err := srv.session.Load(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.session.Put(sessionCtx, "user_id", 1)
+	token, _, err := srv.session.Commit(sessionCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: srv.session.Cookie.Name, Value: token}
+}
+
+// adminActionTests is the data for the admin action routes test, run in order on the staff member,
+// who starts out locked
+var adminActionTests = []struct {
+	name           string
+	url            string
+	expectedActive bool
+	expectedLocked bool
+}{
+	{"unlock", "/admin/unlock-user/2", true, false},
+	{"deactivate", "/admin/users/2/deactivate", false, false},
+	{"activate", "/admin/users/2/activate", true, false},
+}
+
+// TestRoutes_AdminActions tests that actions changing accounts cannot be taken by a link from another site
+func TestRoutes_AdminActions(t *testing.T) {
+	srv := newTestServer(t)
+	mux := srv.routes()
+	token, cookies := csrfToken(t, mux, "/admin/users", loginAdmin(t, srv))
+
+	err := srv.handlers.DB.RecordFailedLogin(context.Background(), 2, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range adminActionTests {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, newFormRequest("GET", e.url, token, cookies))
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusMethodNotAllowed)
+		}
+
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, newFormRequest("POST", e.url, "", cookies))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("POST %s without a CSRF token returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusBadRequest)
+		}
+
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, newFormRequest("POST", e.url, token, cookies))
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("POST %s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		user, err := srv.handlers.DB.GetUserByID(context.Background(), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Active != e.expectedActive || user.LockedUntil.After(time.Now()) != e.expectedLocked {
+			t.Errorf("%s: expected active to be %t and locked to be %t, got %+v", e.name, e.expectedActive, e.expectedLocked, user)
+		}
+	}
+}
+
+// metricsTests is the data for the metrics listener test
+var metricsTests = []struct {
+	name               string
+	authorization      string
+	expectedStatusCode int
+}{
+	{"anonymous", "", http.StatusUnauthorized},
+	{"wrong-token", "Bearer guess", http.StatusUnauthorized},
+	{"not-bearer", "Basic c2VjcmV0", http.StatusUnauthorized},
+	{"token", "Bearer secret", http.StatusOK},
+}
+
+func TestMetricsRoutes(t *testing.T) {
+	srv := newTestServer(t)
+	srv.app.MetricsToken = "secret"
+
+	for _, e := range metricsTests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if e.authorization != "" {
+			req.Header.Set("Authorization", e.authorization)
+		}
+		rr := httptest.NewRecorder()
+		srv.metricsRoutes().ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+
+	// the site itself does not serve metrics at all
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	srv.routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected the site to answer 404 for /metrics, got %d", rr.Code)
+	}
+}
+
+func TestMetricsRoutes_NoToken(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	srv.metricsRoutes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 while no token is configured, got %d", rr.Code)
+	}
+}
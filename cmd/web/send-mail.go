@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"log/slog"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// listenForMail sends every message put on app.MailChan in the background
+func listenForMail(app *config.AppConfig) {
+	go func() {
+		for {
+			msg := <-app.MailChan
+			sendMsg(app, msg)
+		}
+	}()
+}
+
+func sendMsg(app *config.AppConfig, m models.MailData) {
+	from := m.From
+	if from == "" {
+		from = app.MailFrom
+	}
+
+	headers := []string{
+		fmt.Sprintf("From: %s", from),
+		fmt.Sprintf("To: %s", m.To),
+		fmt.Sprintf("Subject: %s", m.Subject),
+		fmt.Sprintf("Date: %s", time.Now().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	body := strings.Join(headers, "\r\n") + "\r\n\r\n" + m.Content
+
+	err := smtp.SendMail(app.SMTPAddr, nil, from, []string{m.To}, []byte(body))
+	if err != nil {
+		app.Logger.Error("cannot send mail", slog.String("to", m.To), slog.String("error", err.Error()))
+		return
+	}
+
+	app.Logger.Info("mail sent", slog.String("to", m.To))
+}
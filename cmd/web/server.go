@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/handlers"
+	"github.com/Sunpacker/go-booking-app/internal/metrics"
+	"github.com/Sunpacker/go-booking-app/internal/render"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"github.com/alexedwards/scs/v2"
+)
+
+// server owns everything one running app needs: its config, the session manager, the renderer,
+// the handlers on top of the repository and the metrics they record. Nothing is kept in package
+// variables, so several servers with their own config can live in one process.
+type server struct {
+	app      *config.AppConfig
+	session  *scs.SessionManager
+	render   *render.Renderer
+	handlers *handlers.Repository
+	metrics  *metrics.Metrics
+}
+
+// newServer sets up a server for the config a, keeping its sessions in session and its data in db.
+// Unless a.TemplateCache is already filled, the templates are parsed from a.TemplateFS.
+func newServer(a *config.AppConfig, session *scs.SessionManager, db repository.DatabaseRepo) (*server, error) {
+	a.Session = session
+	renderer := render.NewRenderer(a)
+
+	if a.TemplateCache == nil {
+		templateCache, err := renderer.CreateTemplateCache()
+		if err != nil {
+			return nil, err
+		}
+		a.TemplateCache = templateCache
+	}
+
+	m := metrics.New()
+
+	return &server{
+		app:      a,
+		session:  session,
+		render:   renderer,
+		handlers: handlers.NewRepo(a, db, renderer, m),
+		metrics:  m,
+	}, nil
+}
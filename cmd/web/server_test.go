@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/Sunpacker/go-booking-app/internal/driver"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewServer_Independent(t *testing.T) {
+	first := newTestServer(t)
+
+	// a config of its own, with a home page of its own
+	second := newTestServer(t)
+	second.app.UseCache = true
+	second.app.TemplateCache = map[string]*template.Template{
+		"home": template.Must(template.New("home").Parse("second home")),
+	}
+
+	for name, e := range map[string]struct {
+		srv      *server
+		expected string
+	}{
+		"first":  {first, "<html"},
+		"second": {second, "second home"},
+	} {
+		rr := httptest.NewRecorder()
+		e.srv.routes().ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), e.expected) {
+			t.Errorf("%s server did not render its own home page: %d %s", name, rr.Code, rr.Body.String())
+		}
+	}
+
+	if first.session == second.session || first.handlers.DB == second.handlers.DB {
+		t.Error("servers share their session or repository")
+	}
+
+	// sql.Open does not connect, which the pool stats do not need
+	pool, err := sql.Open("pgx", "host=localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for _, srv := range []*server{first, second} {
+		err = srv.metrics.RegisterDB(&driver.DB{SQL: pool})
+		if err != nil {
+			t.Errorf("servers share their metrics registry: %v", err)
+		}
+	}
+
+	// each server counts only what happens on it: one home page each, and a failed login on the first
+	first.handlers.Metrics.FailedLogins.Inc()
+	for name, e := range map[string]struct {
+		srv      *server
+		expected []string
+	}{
+		"first":  {first, []string{`booking_http_requests_total{method="GET",route="/",status="200"} 1`, "booking_failed_logins_total 1"}},
+		"second": {second, []string{`booking_http_requests_total{method="GET",route="/",status="200"} 1`, "booking_failed_logins_total 0"}},
+	} {
+		rr := httptest.NewRecorder()
+		e.srv.metrics.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+		for _, expected := range e.expected {
+			if !strings.Contains(rr.Body.String(), expected) {
+				t.Errorf("%s server metrics are missing %s", name, expected)
+			}
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package main
 
 import (
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/logging"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository/dbrepo"
+	"github.com/alexedwards/scs/v2"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
@@ -12,6 +18,24 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// newTestServer returns a server of its own on an in-memory repository, reading the assets from disk
+func newTestServer(t *testing.T) *server {
+	app := &config.AppConfig{
+		Logger:     logging.New(os.Stdout, false, slog.LevelInfo),
+		TemplateFS: os.DirFS("../../templates"),
+		StaticFS:   os.DirFS("../../static"),
+		MailChan:   make(chan models.MailData, 100),
+	}
+
+	srv, err := newServer(app, scs.New(), dbrepo.NewMemoryRepo(app, dbrepo.MemoryData{
+		Rooms: []models.Room{{RoomName: "General's Quarters"}, {RoomName: "Major's Suite"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
 type SkeletonHandler struct{}
 
 func (handler *SkeletonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,8 @@
+// Package assets embeds the templates and static files into the binary,
+// so the app does not depend on the directory it is started from
+package assets
+
+import "embed"
+
+//go:embed templates static
+var FS embed.FS
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"math"
+	"time"
+)
+
+// Throttle decides how long a client has to wait before the next login attempt
+// after a number of consecutive failures
+type Throttle struct {
+	// FreeAttempts is how many failures are allowed before any delay applies
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts; it doubles with each further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the exponential backoff
+	MaxDelay time.Duration
+	// LockAfter is the number of failures after which an account is locked for LockDuration; zero disables locking
+	LockAfter    int
+	LockDuration time.Duration
+}
+
+// AccountThrottle applies to failures against a single account
+var AccountThrottle = Throttle{
+	FreeAttempts: 3,
+	BaseDelay:    2 * time.Second,
+	MaxDelay:     5 * time.Minute,
+	LockAfter:    10,
+	LockDuration: 30 * time.Minute,
+}
+
+// IPThrottle applies to failures from a single IP address within IPWindow, across all accounts
+var IPThrottle = Throttle{
+	FreeAttempts: 10,
+	BaseDelay:    2 * time.Second,
+	MaxDelay:     15 * time.Minute,
+}
+
+// IPWindow is how far back failed logins from an IP address are counted
+const IPWindow = 15 * time.Minute
+
+// Delay returns the backoff that applies after failures consecutive failed attempts
+func (t Throttle) Delay(failures int) time.Duration {
+	excess := failures - t.FreeAttempts
+	if excess <= 0 {
+		return 0
+	}
+
+	// guard against overflowing the shift for very large failure counts
+	if excess > 32 {
+		return t.MaxDelay
+	}
+
+	delay := time.Duration(float64(t.BaseDelay) * math.Pow(2, float64(excess-1)))
+	if delay > t.MaxDelay || delay <= 0 {
+		return t.MaxDelay
+	}
+	return delay
+}
+
+// RetryAfter returns how long to wait at now, given the number of failures and the time of the last one
+func (t Throttle) RetryAfter(failures int, lastFailure, now time.Time) time.Duration {
+	wait := lastFailure.Add(t.Delay(failures)).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// LockUntil returns when an account with failures consecutive failures stops being locked,
+// or the zero time if it should not be locked
+func (t Throttle) LockUntil(failures int, now time.Time) time.Time {
+	if t.LockAfter == 0 || failures < t.LockAfter {
+		return time.Time{}
+	}
+	return now.Add(t.LockDuration)
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle_Delay(t *testing.T) {
+	throttle := Throttle{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	tests := map[int]time.Duration{
+		0:    0,
+		3:    0,
+		4:    time.Second,
+		5:    2 * time.Second,
+		7:    8 * time.Second,
+		20:   time.Minute,
+		1000: time.Minute,
+	}
+
+	for failures, expected := range tests {
+		if got := throttle.Delay(failures); got != expected {
+			t.Errorf("after %d failures expected %s, got %s", failures, expected, got)
+		}
+	}
+}
+
+func TestThrottle_RetryAfter(t *testing.T) {
+	throttle := Throttle{FreeAttempts: 0, BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+	now := time.Now()
+
+	if got := throttle.RetryAfter(1, now.Add(-4*time.Second), now); got != 6*time.Second {
+		t.Errorf("expected 6s left, got %s", got)
+	}
+	if got := throttle.RetryAfter(1, now.Add(-time.Minute), now); got != 0 {
+		t.Errorf("expired backoff should not delay, got %s", got)
+	}
+}
+
+func TestThrottle_LockUntil(t *testing.T) {
+	now := time.Now()
+
+	if !AccountThrottle.LockUntil(AccountThrottle.LockAfter-1, now).IsZero() {
+		t.Error("account locked before reaching the limit")
+	}
+	if got := AccountThrottle.LockUntil(AccountThrottle.LockAfter, now); !got.Equal(now.Add(AccountThrottle.LockDuration)) {
+		t.Errorf("wrong lock end: %s", got)
+	}
+	if !IPThrottle.LockUntil(1000, now).IsZero() {
+		t.Error("throttle without LockAfter must never lock")
+	}
+}
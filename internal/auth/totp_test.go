@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key from the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range tests {
+		code, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("at %d expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+	code, _ := TOTPCode(secret, step)
+	previous, _ := TOTPCode(secret, step-1)
+	stale, _ := TOTPCode(secret, step-5)
+
+	if matched, ok := ValidateTOTP(secret, code, now, 0); !ok || matched != step {
+		t.Error("current code rejected")
+	}
+	if _, ok := ValidateTOTP(secret, previous, now, 0); !ok {
+		t.Error("code from the previous period rejected")
+	}
+	if _, ok := ValidateTOTP(secret, stale, now, 0); ok {
+		t.Error("stale code accepted")
+	}
+	if _, ok := ValidateTOTP(secret, code, now, step); ok {
+		t.Error("code accepted twice")
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Booking App", "me@here.ca", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/Booking%20App:me@here.ca?") || !strings.Contains(uri, "secret=ABC") {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("malformed code %s", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %s", code)
+		}
+		seen[code] = true
+
+		if NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Errorf("%s does not survive normalization", code)
+		}
+	}
+	if len(codes) != 10 {
+		t.Errorf("expected 10 codes, got %d", len(codes))
+	}
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"github.com/Sunpacker/go-booking-app/internal/models"
 	"github.com/alexedwards/scs/v2"
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
+	"time"
 )
 
 type AppConfig struct {
@@ -11,6 +14,43 @@ type AppConfig struct {
 	UseCache      bool
 	TemplateCache map[string]*template.Template
 	Session       *scs.SessionManager
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
+
+	// Logger writes JSON in production and text otherwise; log with the request's context
+	// to include the request ID and user
+	Logger *slog.Logger
+
+	// TemplateFS and StaticFS hold the templates and the public static files. They are embedded
+	// in the binary unless LiveAssets is set, which reads them from disk so edits show up without a rebuild.
+	LiveAssets bool
+	TemplateFS fs.FS
+	StaticFS   fs.FS
+
+	// DemoMode keeps all data and sessions in memory, so the app runs without Postgres
+	DemoMode bool
+
+	ICalSyncInterval time.Duration
+
+	// QueryTimeout limits each database query, on top of the request's own cancellation
+	QueryTimeout time.Duration
+
+	// TraceExporter is where request and repository spans go: "stdout", "otlp" or "none"
+	TraceExporter string
+
+	// SessionStore is "postgres" to keep sessions in the database, or "memory" to lose them on restart
+	SessionStore           string
+	SessionCleanupInterval time.Duration
+
+	// BaseURL is used to build absolute links, e.g. in emails
+	BaseURL  string
+	MailChan chan models.MailData
+	MailFrom string
+	SMTPAddr string
+
+	// MetricsAddr is the internal address /metrics is served on, away from the site. Scrapes must
+	// send MetricsToken as a bearer token; without a token, metrics are not served at all.
+	MetricsAddr  string
+	MetricsToken string
+
+	// RequireManagerTwoFactor keeps managers out of the admin area until they enable two-factor login
+	RequireManagerTwoFactor bool
 }
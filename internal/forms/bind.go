@@ -0,0 +1,329 @@
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxJSONBody limits the size of JSON bodies read by BindRequest
+const maxJSONBody = 1 << 20
+
+// BindRequest reads the input of r into dst, like Bind. JSON bodies are read as an object of
+// field names to values; anything else is parsed as a form, or the query string for GET requests.
+// The returned form holds the input and its validation errors. The error is only set if the input
+// cannot be read at all, or if dst is not a struct Bind can fill.
+func BindRequest(r *http.Request, dst interface{}) (*Form, error) {
+	var values url.Values
+	var err error
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json":
+		values, err = jsonValues(r.Body)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		values = r.URL.Query()
+	default:
+		err = r.ParseForm()
+		values = r.PostForm
+	}
+	if err != nil {
+		return New(nil), err
+	}
+
+	form := New(values)
+	return form, form.Bind(dst)
+}
+
+// jsonValues turns a JSON object into form values. Numbers and booleans are written as text,
+// and arrays become repeated values, so both kinds of input go through the same rules.
+func jsonValues(body io.Reader) (url.Values, error) {
+	if body == nil {
+		return nil, fmt.Errorf("missing body")
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(body, maxJSONBody))
+	decoder.UseNumber()
+
+	var input map[string]interface{}
+	err := decoder.Decode(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for field, value := range input {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+
+		for _, item := range items {
+			switch item := item.(type) {
+			case nil:
+			case string:
+				values.Add(field, item)
+			case json.Number:
+				values.Add(field, item.String())
+			case bool:
+				values.Add(field, strconv.FormatBool(item))
+			default:
+				return nil, fmt.Errorf("field '%s' must be a string, number or boolean", field)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// boundField is a struct field filled from the form field name
+type boundField struct {
+	value reflect.Value
+	name  string
+	rules string
+}
+
+// Bind validates the form by the rules in the tags of dst, a pointer to a struct, then copies
+// the values into its fields. Fields are named by their form tag; untagged ones are left alone,
+// and embedded structs are filled too. Strings, ints, bools and dates (as DateLayout) can be bound.
+//
+// The validate tag lists rules separated by commas, each using the validator of the same meaning:
+//
+//	required            the field cannot be blank
+//	min=N, max=N        length of text
+//	email, url          an email address or an http(s) URL
+//	phone=CODE          a phone number, rewritten to E.164 with CODE as the default calling code
+//	range=LOW:HIGH      a whole number from LOW to HIGH
+//	notpast             a date not before today
+//	after=FIELD         a date after the one in FIELD
+//	stay=FIELD:MIN:MAX  MIN to MAX nights since the date in FIELD, MAX 0 for no limit
+//	matches=FIELD       the same value as FIELD
+//	pattern=REGEXP      text matching REGEXP; always the last rule, as REGEXP may contain commas
+//
+// Input that breaks a rule or cannot be converted ends up in form.Errors; the error returned is
+// for mistakes in dst or its tags.
+func (form *Form) Bind(dst interface{}) error {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("forms: cannot bind to %T, it needs a pointer to a struct", dst)
+	}
+
+	fields := boundFields(target.Elem())
+
+	// rules run first, as some of them rewrite the values that are bound
+	for _, field := range fields {
+		err := form.applyRules(field.name, field.rules)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range fields {
+		err := form.assign(field.value, field.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func boundFields(target reflect.Value) []boundField {
+	var fields []boundField
+
+	for i := 0; i < target.NumField(); i++ {
+		structField := target.Type().Field(i)
+		name := structField.Tag.Get("form")
+
+		if structField.Anonymous && name == "" && structField.Type.Kind() == reflect.Struct {
+			fields = append(fields, boundFields(target.Field(i))...)
+			continue
+		}
+		if name == "" || name == "-" || !structField.IsExported() {
+			continue
+		}
+
+		fields = append(fields, boundField{
+			value: target.Field(i),
+			name:  name,
+			rules: structField.Tag.Get("validate"),
+		})
+	}
+
+	return fields
+}
+
+func (form *Form) applyRules(field, rules string) error {
+	// a pattern takes the rest of the tag
+	var pattern string
+	if i := strings.Index(rules, "pattern="); i == 0 || (i > 0 && rules[i-1] == ',') {
+		pattern = rules[i+len("pattern="):]
+		rules = strings.TrimSuffix(rules[:i], ",")
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		if rule == "" {
+			continue
+		}
+
+		name, argument, _ := strings.Cut(rule, "=")
+		arguments := strings.Split(argument, ":")
+
+		var err error
+		switch name {
+		case "required":
+			form.Required(field)
+		case "min":
+			var length int
+			length, err = strconv.Atoi(argument)
+			if err == nil && form.Has(field) {
+				form.MinLength(field, length)
+			}
+		case "max":
+			var length int
+			length, err = strconv.Atoi(argument)
+			if err == nil {
+				form.MaxLength(field, length)
+			}
+		case "email":
+			if form.Has(field) {
+				form.IsEmail(field)
+			}
+		case "url":
+			if form.Has(field) {
+				form.IsURL(field)
+			}
+		case "phone":
+			form.Phone(field, argument)
+		case "range":
+			var numbers []int
+			numbers, err = ruleNumbers(arguments, 2)
+			if err == nil && form.Has(field) {
+				form.IntRange(field, numbers[0], numbers[1])
+			}
+		case "notpast":
+			form.NotBefore(field, time.Now())
+		case "after":
+			if argument == "" {
+				err = fmt.Errorf("missing field name")
+			} else {
+				form.DateRange(argument, field)
+			}
+		case "stay":
+			var numbers []int
+			numbers, err = ruleNumbers(arguments[1:], 2)
+			if err == nil {
+				form.StayLength(arguments[0], field, numbers[0], numbers[1])
+			}
+		case "matches":
+			if argument == "" {
+				err = fmt.Errorf("missing field name")
+			} else {
+				form.Matches(field, argument)
+			}
+		default:
+			err = fmt.Errorf("unknown rule")
+		}
+
+		if err != nil {
+			return fmt.Errorf("forms: invalid rule '%s' for field '%s': %w", rule, field, err)
+		}
+	}
+
+	if pattern != "" {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return fmt.Errorf("forms: invalid pattern for field '%s': %w", field, err)
+		}
+		form.Pattern(field, re, "This field has the wrong format")
+	}
+
+	return nil
+}
+
+func ruleNumbers(arguments []string, count int) ([]int, error) {
+	if len(arguments) != count {
+		return nil, fmt.Errorf("expected %d numbers", count)
+	}
+
+	numbers := make([]int, count)
+	for i, argument := range arguments {
+		number, err := strconv.Atoi(argument)
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// patterns caches the compiled expressions of pattern rules
+var patterns sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// assign converts the value of field to the type of target. Values that do not convert are
+// reported unless the field already has an error, which then says what is wrong.
+func (form *Form) assign(target reflect.Value, field string) error {
+	value := strings.TrimSpace(form.Get(field))
+	hasErrors := len(form.Errors[field]) > 0
+
+	switch {
+	case target.Type() == timeType:
+		if hasErrors {
+			date, _ := form.parseDate(field)
+			target.Set(reflect.ValueOf(date))
+			return nil
+		}
+		target.Set(reflect.ValueOf(form.Date(field)))
+	case target.Kind() == reflect.String:
+		target.SetString(form.Get(field))
+	case target.Kind() == reflect.Int:
+		if value == "" {
+			return nil
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil && !hasErrors {
+			form.Errors.AddCode(field, CodeNumber, "This field must be a whole number")
+		}
+		target.SetInt(int64(number))
+	case target.Kind() == reflect.Bool:
+		if value == "" {
+			return nil
+		}
+		checked, err := strconv.ParseBool(value)
+		if value == "on" {
+			checked, err = true, nil
+		}
+		if err != nil && !hasErrors {
+			form.Errors.AddCode(field, CodeInvalid, "Invalid value")
+		}
+		target.SetBool(checked)
+	default:
+		return fmt.Errorf("forms: cannot bind field '%s' of type %s", field, target.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package forms
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testGuest struct {
+	Name  string `form:"name" validate:"required,min=2,max=20"`
+	Email string `form:"email" validate:"required,email"`
+	Phone string `form:"phone" validate:"phone=1"`
+}
+
+type testBooking struct {
+	testGuest
+	Start     time.Time `form:"start" validate:"required"`
+	End       time.Time `form:"end" validate:"required,after=start,stay=start:1:14"`
+	Guests    int       `form:"guests" validate:"range=1:4"`
+	Breakfast bool      `form:"breakfast"`
+	Code      string    `form:"code" validate:"pattern=^[A-Z]{3},[0-9]+$"`
+	Internal  string
+}
+
+func TestForm_Bind(t *testing.T) {
+	form := New(url.Values{
+		"name":      {"Jane"},
+		"email":     {"jane@example.com"},
+		"phone":     {"555 555 5555"},
+		"start":     {"2050-01-01"},
+		"end":       {"2050-01-04"},
+		"guests":    {"2"},
+		"breakfast": {"on"},
+		"code":      {"ABC,12"},
+		"Internal":  {"ignored"},
+	})
+
+	var booking testBooking
+	err := form.Bind(&booking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() {
+		t.Fatalf("valid input rejected: %v", form.Errors)
+	}
+
+	if booking.Name != "Jane" || booking.Phone != "+15555555555" || booking.Guests != 2 || !booking.Breakfast ||
+		booking.Code != "ABC,12" || booking.Internal != "" {
+		t.Errorf("fields not bound: %+v", booking)
+	}
+	if !booking.End.Equal(time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date not bound: %s", booking.End)
+	}
+}
+
+func TestForm_Bind_Invalid(t *testing.T) {
+	form := New(url.Values{
+		"name":   {"J"},
+		"start":  {"2050-01-05"},
+		"end":    {"2050-01-01"},
+		"guests": {"many"},
+		"code":   {"abc"},
+	})
+
+	var booking testBooking
+	err := form.Bind(&booking)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"name":   CodeMinLength,
+		"email":  CodeRequired,
+		"end":    CodeDateOrder,
+		"guests": CodeNumber,
+		"code":   CodePattern,
+	}
+	for field, code := range expected {
+		if form.Errors.Code(field) != code {
+			t.Errorf("%s: expected %s, got '%s'", field, code, form.Errors.Code(field))
+		}
+	}
+	if len(form.Errors["guests"]) != 1 {
+		t.Error("a field that is not a number was reported more than once")
+	}
+}
+
+func TestForm_Bind_BadTarget(t *testing.T) {
+	form := New(url.Values{})
+
+	var notStruct string
+	if form.Bind(&notStruct) == nil {
+		t.Error("bound to a string")
+	}
+
+	var unknownRule struct {
+		Name string `form:"name" validate:"shiny"`
+	}
+	if form.Bind(&unknownRule) == nil {
+		t.Error("unknown rule accepted")
+	}
+
+	var unsupported struct {
+		Price float64 `form:"price"`
+	}
+	if form.Bind(&unsupported) == nil {
+		t.Error("unsupported field type accepted")
+	}
+}
+
+func TestBindRequest(t *testing.T) {
+	body := `{"name": "Jane", "email": "jane@example.com", "start": "2050-01-01", "end": "2050-01-03", "guests": 3, "breakfast": true}`
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	var booking testBooking
+	form, err := BindRequest(req, &booking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() || booking.Guests != 3 || !booking.Breakfast || booking.Email != "jane@example.com" {
+		t.Errorf("json not bound: %+v %v", booking, form.Errors)
+	}
+
+	req, _ = http.NewRequest("POST", "/", strings.NewReader(`{"name": {"first": "Jane"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	_, err = BindRequest(req, &booking)
+	if err == nil {
+		t.Error("nested object accepted")
+	}
+
+	req, _ = http.NewRequest("POST", "/", strings.NewReader(url.Values{"guests": {"9"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form, err = BindRequest(req, &booking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Errors.Code("guests") != CodeRange {
+		t.Error("posted form not validated")
+	}
+
+	req, _ = http.NewRequest("GET", "/?name=Jane", nil)
+	form, _ = BindRequest(req, &booking)
+	if booking.Name != "Jane" || form.Errors.Code("name") != "" {
+		t.Error("query string not bound on GET")
+	}
+}
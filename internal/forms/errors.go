@@ -1,16 +1,96 @@
 package forms
 
-type errors map[string][]string
+import (
+	"encoding/json"
+	"fmt"
+)
 
-func (e errors) Add(field, message string) {
-	e[field] = append(e[field], message)
+// Error codes name the rule a field broke, so clients can tell errors apart in any language
+const (
+	CodeInvalid   = "invalid"
+	CodeRequired  = "required"
+	CodeMinLength = "min_length"
+	CodeMaxLength = "max_length"
+	CodeEmail     = "email"
+	CodeURL       = "url"
+	CodePassword  = "weak_password"
+	CodeMismatch  = "mismatch"
+	CodeDate      = "date"
+	CodeDateOrder = "date_order"
+	CodePastDate  = "past_date"
+	CodeMinStay   = "min_stay"
+	CodeMaxStay   = "max_stay"
+	CodeNumber    = "number"
+	CodeRange     = "range"
+	CodePhone     = "phone"
+	CodePattern   = "pattern"
+)
+
+type errors map[string][]Message
+
+// Message is a validation error. Its format is the English source text, also used as the
+// translation key, so it is kept untranslated until the form is shown in the request's language.
+type Message struct {
+	Code   string
+	Format string
+	Args   []interface{}
+	text   string
+}
+
+// String returns the translated message, or the English one if the form was never localized
+func (m Message) String() string {
+	if m.text != "" {
+		return m.text
+	}
+	if len(m.Args) == 0 {
+		return m.Format
+	}
+	return fmt.Sprintf(m.Format, m.Args...)
+}
+
+// MarshalJSON writes the message as its code and text, for clients that need both
+func (m Message) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{m.Code, m.String()})
+}
+
+// Add records an error that no built-in rule covers, with the code CodeInvalid
+func (e errors) Add(field, format string, args ...interface{}) {
+	e.AddCode(field, CodeInvalid, format, args...)
+}
+
+// AddCode records an error with the code of the rule that was broken
+func (e errors) AddCode(field, code, format string, args ...interface{}) {
+	e[field] = append(e[field], Message{Code: code, Format: format, Args: args})
 }
 
 func (e errors) Get(field string) string {
-	errorString := e[field]
-	if len(errorString) == 0 {
+	messages := e[field]
+	if len(messages) == 0 {
+		return ""
+	}
+
+	return messages[0].String()
+}
+
+// Code returns the code of the first error of field, or an empty string if it has none
+func (e errors) Code(field string) string {
+	messages := e[field]
+	if len(messages) == 0 {
 		return ""
 	}
 
-	return errorString[0]
+	return messages[0].Code
+}
+
+// First returns the first message of the first of fields that has errors
+func (e errors) First(fields ...string) string {
+	for _, field := range fields {
+		if message := e.Get(field); message != "" {
+			return message
+		}
+	}
+	return ""
 }
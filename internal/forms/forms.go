@@ -1,10 +1,11 @@
 package forms
 
 import (
-	"fmt"
 	"github.com/asaskevich/govalidator"
 	"net/url"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Form struct {
@@ -15,7 +16,17 @@ type Form struct {
 func New(data url.Values) *Form {
 	return &Form{
 		data,
-		errors(map[string][]string{}),
+		errors(map[string][]Message{}),
+	}
+}
+
+// Localize translates the error messages with translate, which gets each message's format and arguments
+func (form *Form) Localize(translate func(format string, args ...interface{}) string) {
+	for field, messages := range form.Errors {
+		for i, message := range messages {
+			messages[i].text = translate(message.Format, message.Args...)
+		}
+		form.Errors[field] = messages
 	}
 }
 
@@ -35,20 +46,57 @@ func (form *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := form.Get(field)
 		if strings.TrimSpace(value) == "" {
-			form.Errors.Add(field, "This field cannot be blank")
+			form.Errors.AddCode(field, CodeRequired, "This field cannot be blank")
 		}
 	}
 }
 
+// MinLength requires field to be at least length characters long
 func (form *Form) MinLength(field string, length int) {
-	value := form.Get(field)
-	if len(value) < length {
-		form.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", length))
+	if utf8.RuneCountInString(form.Get(field)) < length {
+		form.Errors.AddCode(field, CodeMinLength, "This field must be at least %d characters long", length)
 	}
 }
 
 func (form *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(form.Get(field)) {
-		form.Errors.Add(field, "Invalid email address")
+		form.Errors.AddCode(field, CodeEmail, "Invalid email address")
+	}
+}
+
+func (form *Form) IsURL(field string) {
+	value := form.Get(field)
+	if !govalidator.IsRequestURL(value) || !(strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")) {
+		form.Errors.AddCode(field, CodeURL, "Invalid URL")
+	}
+}
+
+const minPasswordLength = 10
+
+// StrongPassword requires at least minPasswordLength characters mixing letters with digits or symbols
+func (form *Form) StrongPassword(field string) {
+	value := form.Get(field)
+
+	if len([]rune(value)) < minPasswordLength {
+		form.Errors.AddCode(field, CodePassword, "Password must be at least %d characters long", minPasswordLength)
+		return
+	}
+
+	hasLetter, hasOther := false, false
+	for _, c := range value {
+		if unicode.IsLetter(c) {
+			hasLetter = true
+		} else if !unicode.IsSpace(c) {
+			hasOther = true
+		}
+	}
+	if !hasLetter || !hasOther {
+		form.Errors.AddCode(field, CodePassword, "Password must contain letters and at least one digit or symbol")
+	}
+}
+
+func (form *Form) Matches(field, otherField string) {
+	if form.Get(field) != form.Get(otherField) {
+		form.Errors.AddCode(field, CodeMismatch, "Values do not match")
 	}
 }
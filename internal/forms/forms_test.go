@@ -74,6 +74,20 @@ func TestForm_MinLength(t *testing.T) {
 	}
 }
 
+func TestForm_MinLength_NonASCII(t *testing.T) {
+	form := New(url.Values{"short": {"Ян"}, "long": {"Иван"}})
+
+	form.MinLength("short", 3)
+	form.MinLength("long", 3)
+
+	if form.Errors.Code("short") != CodeMinLength {
+		t.Errorf("two cyrillic letters, four bytes, counted as long enough: '%s'", form.Errors.Code("short"))
+	}
+	if form.Errors.Code("long") != "" {
+		t.Error("four cyrillic letters counted as too short")
+	}
+}
+
 func TestForm_IsEmail(t *testing.T) {
 	emailToTest := "ivan@ya.ru"
 
@@ -93,6 +107,87 @@ func TestForm_IsEmail(t *testing.T) {
 	}
 }
 
+func TestForm_IsURL(t *testing.T) {
+	formData := url.Values{}
+	formData.Add("url", "https://calendar.example.com/feed.ics?key=1")
+	formData.Add("ftp", "ftp://calendar.example.com/feed.ics")
+	formData.Add("text", "not a url")
+
+	form := getTestForm(formData)
+
+	form.IsURL("url")
+	if !form.Valid() {
+		t.Error("https url should be valid, but got invalid")
+	}
+
+	form.IsURL("ftp")
+	if form.Errors.Get("ftp") == "" {
+		t.Error("ftp url must be invalid, but its valid")
+	}
+
+	form.IsURL("text")
+	if form.Errors.Get("text") == "" {
+		t.Error("plain text must be invalid, but its valid")
+	}
+}
+
+func TestForm_StrongPassword(t *testing.T) {
+	formData := url.Values{}
+	formData.Add("short", "ab1")
+	formData.Add("letters", "onlyletterstoolong")
+	formData.Add("digits", "12345678901")
+	formData.Add("strong", "correct horse 9")
+
+	form := getTestForm(formData)
+
+	form.StrongPassword("strong")
+	if !form.Valid() {
+		t.Error("strong password should be valid, but got invalid")
+	}
+
+	for _, field := range []string{"short", "letters", "digits"} {
+		form.StrongPassword(field)
+		if form.Errors.Get(field) == "" {
+			t.Errorf("weak password '%s' must be invalid, but its valid", formData.Get(field))
+		}
+	}
+}
+
+func TestForm_Matches(t *testing.T) {
+	formData := url.Values{}
+	formData.Add("password", "secret-1234")
+	formData.Add("password_confirm", "secret-1234")
+	formData.Add("other", "secret-12345")
+
+	form := getTestForm(formData)
+
+	form.Matches("password_confirm", "password")
+	if !form.Valid() {
+		t.Error("equal values should match, but got invalid")
+	}
+
+	form.Matches("other", "password")
+	if form.Errors.Get("other") == "" {
+		t.Error("different values must not match")
+	}
+}
+
+func TestForm_Localize(t *testing.T) {
+	form := getTestForm(nil)
+	form.MinLength("name", 3)
+
+	if form.Errors.Get("name") != "This field must be at least 3 characters long" {
+		t.Errorf("wrong message before localizing: %s", form.Errors.Get("name"))
+	}
+
+	form.Localize(func(format string, args ...interface{}) string {
+		return fmt.Sprintf("["+format+"]", args...)
+	})
+	if form.Errors.Get("name") != "[This field must be at least 3 characters long]" {
+		t.Errorf("message not translated: %s", form.Errors.Get("name"))
+	}
+}
+
 func getTestForm(formData url.Values) *Form {
 	if formData != nil {
 		return New(formData)
@@ -0,0 +1,141 @@
+package forms
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DateLayout is how dates are written in forms
+const DateLayout = "2006-01-02"
+
+// The rules below skip blank fields, leaving those to Required, so optional fields can use them too
+
+// MaxLength requires field to be at most length characters long
+func (form *Form) MaxLength(field string, length int) {
+	if utf8.RuneCountInString(form.Get(field)) > length {
+		form.Errors.AddCode(field, CodeMaxLength, "This field cannot be longer than %d characters", length)
+	}
+}
+
+// Date reads field as a date, returning the zero time if it is blank or not a valid date
+func (form *Form) Date(field string) time.Time {
+	value := strings.TrimSpace(form.Get(field))
+	if value == "" {
+		return time.Time{}
+	}
+
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		form.Errors.AddCode(field, CodeDate, "Enter a date as YYYY-MM-DD")
+		return time.Time{}
+	}
+	return date
+}
+
+// DateRange requires the date in endField to come after the one in startField
+func (form *Form) DateRange(startField, endField string) {
+	start, end, ok := form.datePair(startField, endField)
+	if ok && !end.After(start) {
+		form.Errors.AddCode(endField, CodeDateOrder, "The end date must be after the start date")
+	}
+}
+
+// NotBefore requires the date in field to be on or after earliest, such as today for arrivals
+func (form *Form) NotBefore(field string, earliest time.Time) {
+	date, ok := form.parseDate(field)
+	earliest = time.Date(earliest.Year(), earliest.Month(), earliest.Day(), 0, 0, 0, 0, time.UTC)
+	if ok && date.Before(earliest) {
+		form.Errors.AddCode(field, CodePastDate, "This date cannot be before %s", earliest.Format(DateLayout))
+	}
+}
+
+// StayLength requires between minNights and maxNights nights from startField to endField.
+// A maxNights of zero means there is no upper limit.
+func (form *Form) StayLength(startField, endField string, minNights, maxNights int) {
+	start, end, ok := form.datePair(startField, endField)
+	if !ok || !end.After(start) {
+		// DateRange reports stays that end before they start
+		return
+	}
+
+	nights := int(end.Sub(start).Hours() / 24)
+	switch {
+	case nights < minNights:
+		form.Errors.AddCode(endField, CodeMinStay, "The stay must be at least %d nights long", minNights)
+	case maxNights > 0 && nights > maxNights:
+		form.Errors.AddCode(endField, CodeMaxStay, "The stay cannot be longer than %d nights", maxNights)
+	}
+}
+
+// IntRange requires field to be a whole number from lowest to highest, and returns it
+func (form *Form) IntRange(field string, lowest, highest int) int {
+	value := strings.TrimSpace(form.Get(field))
+	if value == "" {
+		return 0
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		form.Errors.AddCode(field, CodeNumber, "This field must be a whole number")
+		return 0
+	}
+	if number < lowest || number > highest {
+		form.Errors.AddCode(field, CodeRange, "This field must be between %d and %d", lowest, highest)
+	}
+	return number
+}
+
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+// Phone checks that field is a plausible phone number and rewrites it in E.164 form, like +15555555555.
+// Numbers starting without + or 00 are national numbers of defaultCallingCode, with a leading trunk 0 dropped;
+// they are rejected if defaultCallingCode is empty.
+func (form *Form) Phone(field, defaultCallingCode string) {
+	number := phoneSeparators.Replace(strings.TrimSpace(form.Get(field)))
+	if number == "" {
+		return
+	}
+
+	international := true
+	switch {
+	case strings.HasPrefix(number, "+"):
+		number = number[1:]
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case defaultCallingCode != "":
+		number = defaultCallingCode + strings.TrimPrefix(number, "0")
+	default:
+		international = false
+	}
+
+	// E.164 numbers have at most 15 digits, and no country code starts with 0
+	if !international || len(number) < 8 || len(number) > 15 || number[0] == '0' || strings.Trim(number, "0123456789") != "" {
+		form.Errors.AddCode(field, CodePhone, "Invalid phone number")
+		return
+	}
+
+	form.Set(field, "+"+number)
+}
+
+// Pattern requires field to match re. The message says what was expected and is translated like the built-in ones.
+func (form *Form) Pattern(field string, re *regexp.Regexp, message string) {
+	value := form.Get(field)
+	if value != "" && !re.MatchString(value) {
+		form.Errors.AddCode(field, CodePattern, message)
+	}
+}
+
+// parseDate reads field as a date without reporting errors, which Date does
+func (form *Form) parseDate(field string) (time.Time, bool) {
+	date, err := time.Parse(DateLayout, strings.TrimSpace(form.Get(field)))
+	return date, err == nil
+}
+
+func (form *Form) datePair(startField, endField string) (time.Time, time.Time, bool) {
+	start, startOK := form.parseDate(startField)
+	end, endOK := form.parseDate(endField)
+	return start, end, startOK && endOK
+}
@@ -0,0 +1,146 @@
+package forms
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestForm_MaxLength(t *testing.T) {
+	form := New(url.Values{"short": {"Jürgen"}, "long": {"Maximilian"}})
+
+	form.MaxLength("short", 6)
+	form.MaxLength("long", 6)
+
+	if form.Errors.Code("short") != "" {
+		t.Error("six letters with an umlaut counted as too long")
+	}
+	if form.Errors.Code("long") != CodeMaxLength {
+		t.Errorf("expected %s, got '%s'", CodeMaxLength, form.Errors.Code("long"))
+	}
+}
+
+func TestForm_Date(t *testing.T) {
+	form := New(url.Values{"good": {"2050-01-02"}, "bad": {"02/01/2050"}})
+
+	if !form.Date("good").Equal(time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Error("valid date not parsed")
+	}
+	if !form.Date("bad").IsZero() || form.Errors.Code("bad") != CodeDate {
+		t.Error("invalid date accepted")
+	}
+	if !form.Date("missing").IsZero() || form.Errors.Code("missing") != "" {
+		t.Error("blank date reported as invalid")
+	}
+}
+
+var dateRuleTests = []struct {
+	name         string
+	start        string
+	end          string
+	expectedCode string
+}{
+	{"valid", "2050-01-01", "2050-01-04", ""},
+	{"same-day", "2050-01-01", "2050-01-01", CodeDateOrder},
+	{"reversed", "2050-01-04", "2050-01-01", CodeDateOrder},
+	{"too-short", "2050-01-01", "2050-01-02", CodeMinStay},
+	{"too-long", "2050-01-01", "2050-03-01", CodeMaxStay},
+	{"unparsable", "2050-01-01", "soon", ""},
+}
+
+func TestForm_DateRangeAndStayLength(t *testing.T) {
+	for _, e := range dateRuleTests {
+		form := New(url.Values{"start": {e.start}, "end": {e.end}})
+
+		form.DateRange("start", "end")
+		form.StayLength("start", "end", 2, 30)
+
+		if form.Errors.Code("end") != e.expectedCode {
+			t.Errorf("%s: expected code '%s', got '%s'", e.name, e.expectedCode, form.Errors.Code("end"))
+		}
+		if len(form.Errors["end"]) > 1 {
+			t.Errorf("%s: reported more than one error", e.name)
+		}
+	}
+}
+
+func TestForm_NotBefore(t *testing.T) {
+	today := time.Date(2050, 1, 2, 15, 30, 0, 0, time.UTC)
+	form := New(url.Values{"yesterday": {"2050-01-01"}, "today": {"2050-01-02"}})
+
+	form.NotBefore("yesterday", today)
+	form.NotBefore("today", today)
+
+	if form.Errors.Code("yesterday") != CodePastDate {
+		t.Error("date in the past accepted")
+	}
+	if form.Errors.Code("today") != "" {
+		t.Error("today rejected because of the time of day")
+	}
+}
+
+func TestForm_IntRange(t *testing.T) {
+	form := New(url.Values{"guests": {"3"}, "many": {"12"}, "word": {"two"}})
+
+	if form.IntRange("guests", 1, 4) != 3 || form.Errors.Code("guests") != "" {
+		t.Error("number in range rejected")
+	}
+	form.IntRange("many", 1, 4)
+	if form.Errors.Code("many") != CodeRange {
+		t.Error("number out of range accepted")
+	}
+	form.IntRange("word", 1, 4)
+	if form.Errors.Code("word") != CodeNumber {
+		t.Error("text accepted as a number")
+	}
+}
+
+var phoneTests = []struct {
+	input    string
+	expected string
+	valid    bool
+}{
+	{"555-555-5555", "+15555555555", true},
+	{"+44 (20) 7946 0958", "+442079460958", true},
+	{"0044 20 7946 0958", "+442079460958", true},
+	{"(0)555 555 5555", "+15555555555", true},
+	{"12345", "", false},
+	{"+1 555 CALL NOW", "", false},
+	{"+1234567890123456", "", false},
+}
+
+func TestForm_Phone(t *testing.T) {
+	for _, e := range phoneTests {
+		form := New(url.Values{"phone": {e.input}})
+		form.Phone("phone", "1")
+
+		if form.Valid() != e.valid {
+			t.Errorf("%s: expected valid to be %v", e.input, e.valid)
+		}
+		if e.valid && form.Get("phone") != e.expected {
+			t.Errorf("%s: normalized to %s, wanted %s", e.input, form.Get("phone"), e.expected)
+		}
+	}
+
+	form := New(url.Values{"phone": {"555-555-5555"}})
+	form.Phone("phone", "")
+	if form.Errors.Code("phone") != CodePhone {
+		t.Error("national number accepted without a default calling code")
+	}
+}
+
+func TestForm_Pattern(t *testing.T) {
+	form := New(url.Values{"code": {"ABC123"}, "other": {"abc"}})
+	upperAlnum := regexp.MustCompile(`^[A-Z0-9]+$`)
+
+	form.Pattern("code", upperAlnum, "Use capital letters and digits only")
+	form.Pattern("other", upperAlnum, "Use capital letters and digits only")
+
+	if form.Errors.Code("code") != "" {
+		t.Error("matching value rejected")
+	}
+	if form.Errors.Code("other") != CodePattern || form.Errors.Get("other") != "Use capital letters and digits only" {
+		t.Error("value not matching the pattern accepted")
+	}
+}
@@ -1,55 +1,85 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"github.com/Sunpacker/go-booking-app/internal/auth"
 	"github.com/Sunpacker/go-booking-app/internal/config"
 	"github.com/Sunpacker/go-booking-app/internal/driver"
 	"github.com/Sunpacker/go-booking-app/internal/forms"
 	"github.com/Sunpacker/go-booking-app/internal/helpers"
+	"github.com/Sunpacker/go-booking-app/internal/i18n"
+	"github.com/Sunpacker/go-booking-app/internal/ical"
+	"github.com/Sunpacker/go-booking-app/internal/metrics"
 	"github.com/Sunpacker/go-booking-app/internal/models"
 	"github.com/Sunpacker/go-booking-app/internal/render"
 	"github.com/Sunpacker/go-booking-app/internal/repository"
 	"github.com/Sunpacker/go-booking-app/internal/repository/dbrepo"
 	"github.com/go-chi/chi"
-	"log"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
-var Repo *Repository
-
+// Repository is what the handlers work with: the app config, with its session, the database,
+// the renderer of the pages and the metrics of the app. Every handler is a method of it, so each
+// app gets its own.
 type Repository struct {
-	App *config.AppConfig
-	DB  repository.DatabaseRepo
+	App     *config.AppConfig
+	DB      repository.DatabaseRepo
+	Render  *render.Renderer
+	Metrics *metrics.Metrics
 }
 
 func CreateNewRepo(a *config.AppConfig, db *driver.DB) *Repository {
+	return NewRepo(a, dbrepo.NewPostgresRepo(db.SQL, a), render.NewRenderer(a), metrics.New())
+}
+
+// NewRepo creates the handlers' repository on top of any database implementation, such as the in-memory one.
+// Calls to the database are recorded in m, as are reservations, searches and failed logins.
+func NewRepo(a *config.AppConfig, db repository.DatabaseRepo, renderer *render.Renderer, m *metrics.Metrics) *Repository {
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+		App:     a,
+		DB:      dbrepo.NewInstrumentedRepo(db, m),
+		Render:  renderer,
+		Metrics: m,
 	}
 }
 
 func NewTestRepo(a *config.AppConfig) *Repository {
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewTestRepo(a),
+		App:     a,
+		DB:      dbrepo.NewTestRepo(a),
+		Render:  render.NewRenderer(a),
+		Metrics: metrics.New(),
 	}
 }
 
-func NewHandlers(r *Repository) {
-	Repo = r
+// NotFound renders the error page for unknown URLs
+func (m *Repository) NotFound(w http.ResponseWriter, r *http.Request) {
+	_ = m.Render.TemplateWithStatus(w, r, http.StatusNotFound, "error",
+		render.ErrorData(http.StatusNotFound, "The page you are looking for does not exist."))
+}
+
+// MethodNotAllowed renders the error page for known URLs requested with the wrong method
+func (m *Repository) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	_ = m.Render.TemplateWithStatus(w, r, http.StatusMethodNotAllowed, "error",
+		render.ErrorData(http.StatusMethodNotAllowed, "This page cannot be requested this way."))
 }
 
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "home", &models.TemplateData{})
+	_ = m.Render.Template(w, r, "home", &models.TemplateData{})
 }
 
 func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "about", &models.TemplateData{})
+	_ = m.Render.Template(w, r, "about", &models.TemplateData{})
 }
 
 func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +90,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(reservation.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), reservation.RoomID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot find room")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -79,76 +109,88 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
 
-	_ = render.Template(w, r, "make-reservation", &models.TemplateData{
+	_ = m.Render.Template(w, r, "make-reservation", &models.TemplateData{
 		Form:      forms.New(nil),
 		Data:      data,
 		StringMap: stringMap,
 	})
 }
-func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse form!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
-	}
 
-	sd := r.Form.Get("start_date")
-	ed := r.Form.Get("end_date")
-
-	// 2020-01-01 -- 01/02 03:04:05PM '06 -0700
+// guestInput is the contact details of the guest on a reservation.
+// Phone numbers without a country code are taken as North American.
+type guestInput struct {
+	FirstName string `form:"first_name" validate:"required,min=3,max=100"`
+	LastName  string `form:"last_name" validate:"required,max=100"`
+	Email     string `form:"email" validate:"required,email"`
+	Phone     string `form:"phone" validate:"phone=1"`
+}
 
-	layout := "2006-01-02"
+// reservationInput is what a guest posts to book a room, for a stay of 1 to 30 nights
+type reservationInput struct {
+	guestInput
+	StartDate time.Time `form:"start_date" validate:"required,notpast"`
+	EndDate   time.Time `form:"end_date" validate:"required,after=start_date,stay=start_date:1:30"`
+	RoomID    int       `form:"room_id" validate:"required"`
+}
 
-	startDate, err := time.Parse(layout, sd)
+func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
+	var input reservationInput
+	form, err := forms.BindRequest(r, &input)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date")
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	endDate, err := time.Parse(layout, ed)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't get parse end date")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
+	// the dates and the room come from hidden fields, so missing ones mean the form was tampered with
+	var tampered string
+	switch {
+	case input.StartDate.IsZero():
+		tampered = "can't parse start date"
+	case input.EndDate.IsZero():
+		tampered = "can't get parse end date"
+	case input.RoomID == 0:
+		tampered = "invalid data!"
 	}
-
-	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "invalid data!")
+	if tampered != "" {
+		m.App.Session.Put(r.Context(), "error", tampered)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	reservation := models.Reservation{
-		FirstName: r.Form.Get("first_name"),
-		LastName:  r.Form.Get("last_name"),
-		Phone:     r.Form.Get("phone"),
-		Email:     r.Form.Get("email"),
-		StartDate: startDate,
-		EndDate:   endDate,
-		RoomID:    roomID,
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+		Phone:     input.Phone,
+		Email:     input.Email,
+		StartDate: input.StartDate,
+		EndDate:   input.EndDate,
+		RoomID:    input.RoomID,
 	}
 
-	form := forms.New(r.PostForm)
-
-	form.Required("first_name", "last_name", "email")
-	form.MinLength("first_name", 3)
-	form.IsEmail("email")
-
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
-		http.Error(w, "my own error message", http.StatusSeeOther)
-		_ = render.Template(w, r, "make-reservation", &models.TemplateData{
-			Form: form,
-			Data: data,
+
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = form.Get("start_date")
+		stringMap["end_date"] = form.Get("end_date")
+
+		_ = m.Render.Template(w, r, "make-reservation", &models.TemplateData{
+			Form:      form,
+			Data:      data,
+			StringMap: stringMap,
 		})
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	reservation.ConfirmationCode, err = helpers.NewConfirmationCode()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	newReservationID, err := m.DB.InsertReservation(r.Context(), reservation)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -156,76 +198,81 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	restriction := models.RoomRestriction{
-		StartDate:     startDate,
-		EndDate:       endDate,
-		RoomID:        roomID,
+		StartDate:     reservation.StartDate,
+		EndDate:       reservation.EndDate,
+		RoomID:        reservation.RoomID,
 		ReservationID: newReservationID,
-		RestrictionID: 1,
+		RestrictionID: models.RestrictionReservation,
 	}
 
-	err = m.DB.InsertRoomRestriction(restriction)
+	err = m.DB.InsertRoomRestriction(r.Context(), restriction)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't insert room restriction!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	m.Metrics.ReservationsCreated.Inc()
 
 	m.App.Session.Put(r.Context(), "reservation", reservation)
 	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 }
 
 func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "generals", &models.TemplateData{})
+	_ = m.Render.Template(w, r, "generals", &models.TemplateData{})
 }
 
 func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "majors", &models.TemplateData{})
+	_ = m.Render.Template(w, r, "majors", &models.TemplateData{})
 }
 
 func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "search-availability", &models.TemplateData{})
+	_ = m.Render.Template(w, r, "search-availability", &models.TemplateData{})
 }
-func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse form!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
-	}
 
-	start := r.Form.Get("start")
-	end := r.Form.Get("end")
+// availabilityInput is a search for rooms free between two dates, or for just one room if RoomID is set
+type availabilityInput struct {
+	StartDate time.Time `form:"start" validate:"required"`
+	EndDate   time.Time `form:"end" validate:"required,after=start"`
+	RoomID    int       `form:"room_id"`
+}
 
-	// 01/02 03:04:05PM '06 -0700
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start)
+func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
+	var input availabilityInput
+	form, err := forms.BindRequest(r, &input)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		m.respondError(w, r, http.StatusBadRequest, "can't parse form!", "/", http.StatusTemporaryRedirect)
 		return
 	}
-	endDate, err := time.Parse(layout, end)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	if !form.Valid() {
+		m.respondInvalid(w, r, form, "/", http.StatusTemporaryRedirect, "start", "end")
 		return
 	}
+	startDate, endDate := input.StartDate, input.EndDate
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	rooms, err := m.availableRooms(r.Context(), startDate, endDate, input.RoomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.respondError(w, r, http.StatusNotFound, "cannot find room", "/", http.StatusTemporaryRedirect)
+		return
+	} else if err != nil {
+		m.respondError(w, r, http.StatusInternalServerError, "can't get availability for rooms", "/", http.StatusTemporaryRedirect)
 		return
 	}
+	m.Metrics.AvailabilitySearches.WithLabelValues(metrics.SearchResult(len(rooms) > 0)).Inc()
 
-	if len(rooms) == 0 {
+	if len(rooms) == 0 && !render.Negotiate(w, r) {
 		m.App.Session.Put(r.Context(), "error", "No available room")
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
 	data := make(map[string]interface{})
+	data["ok"] = len(rooms) > 0
+	data["start_date"] = startDate.Format(dateLayout)
+	data["end_date"] = endDate.Format(dateLayout)
 	data["rooms"] = rooms
+	if input.RoomID > 0 {
+		data["room_id"] = input.RoomID
+	}
 
 	reservation := models.Reservation{
 		StartDate: startDate,
@@ -233,70 +280,126 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	}
 
 	m.App.Session.Put(r.Context(), "reservation", reservation)
-	_ = render.Template(w, r, "choose-room", &models.TemplateData{
+
+	_ = m.Render.Respond(w, r, http.StatusOK, "choose-room", &models.TemplateData{
 		Data: data,
 	})
 }
 
-type jsonResponse struct {
-	Ok        bool   `json:"ok"`
-	Message   string `json:"message"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
-	RoomID    string `json:"room_id"`
-}
+// availableRooms returns the rooms free from start to end, never nil. With a roomID, only that room
+// is checked; sql.ErrNoRows means there is no such room.
+func (m *Repository) availableRooms(ctx context.Context, start, end time.Time, roomID int) ([]models.Room, error) {
+	if roomID == 0 {
+		rooms, err := m.DB.SearchAvailabilityForAllRooms(ctx, start, end)
+		if rooms == nil {
+			rooms = []models.Room{}
+		}
+		return rooms, err
+	}
 
-func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	room, err := m.DB.GetRoomByID(ctx, roomID)
 	if err != nil {
-		resp := jsonResponse{
-			Ok:      false,
-			Message: "Internal server error",
-		}
+		return nil, err
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(ctx, start, end, roomID)
+	if err != nil || !available {
+		return []models.Room{}, err
+	}
+
+	return []models.Room{{ID: room.ID, RoomName: room.RoomName}}, nil
+}
+
+// dateLayout is how dates are written in forms, query strings and JSON
+const dateLayout = "2006-01-02"
 
-		out, _ := json.MarshalIndent(resp, "", "     ")
-		w.Header().Set("Content-Type", "application/json")
-		_, _ = w.Write(out)
+// respondError reports a failed request: JSON clients get status and message,
+// browsers are redirected to location and shown the message there
+func (m *Repository) respondError(w http.ResponseWriter, r *http.Request, status int, message, location string, redirectStatus int) {
+	if render.Negotiate(w, r) {
+		_ = render.JSONError(w, status, translate(r, message))
 		return
 	}
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
+	m.App.Session.Put(r.Context(), "error", message)
+	http.Redirect(w, r, location, redirectStatus)
+}
 
-	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+// invalidInputPayload is the JSON answer to input that failed validation
+type invalidInputPayload struct {
+	Ok      bool                       `json:"ok"`
+	Message string                     `json:"message"`
+	Errors  map[string][]forms.Message `json:"errors"`
+}
+
+// invalidInput describes the errors of form in the language of the request.
+// The message is the first error of fields, in the order they are given.
+func invalidInput(r *http.Request, form *forms.Form, fields ...string) invalidInputPayload {
+	form.Localize(func(format string, args ...interface{}) string {
+		return translate(r, format, args...)
+	})
 
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	return invalidInputPayload{
+		Ok:      false,
+		Message: form.Errors.First(fields...),
+		Errors:  form.Errors,
+	}
+}
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
-	if err != nil {
-		// got a database error, so return appropriate json
-		resp := jsonResponse{
-			Ok:      false,
-			Message: "Error querying database",
-		}
+// respondInvalid reports input that failed validation: JSON clients get the errors of every field,
+// browsers are redirected to location and shown the first error of fields there
+func (m *Repository) respondInvalid(w http.ResponseWriter, r *http.Request, form *forms.Form, location string, redirectStatus int, fields ...string) {
+	payload := invalidInput(r, form, fields...)
+
+	if render.Negotiate(w, r) {
+		_ = render.JSON(w, http.StatusUnprocessableEntity, payload)
+		return
+	}
 
-		out, _ := json.MarshalIndent(resp, "", "     ")
-		w.Header().Set("Content-Type", "application/json")
-		_, _ = w.Write(out)
+	m.App.Session.Put(r.Context(), "error", payload.Message)
+	http.Redirect(w, r, location, redirectStatus)
+}
+
+// translate puts a message into the language of the request. Messages stored in the session
+// are translated when shown, so this is only needed for those with arguments.
+func translate(r *http.Request, format string, args ...interface{}) string {
+	return i18n.T(i18n.FromContext(r.Context()), format, args...)
+}
+
+// PostLocale switches the language of the site for the rest of the session
+func (m *Repository) PostLocale(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	resp := jsonResponse{
-		Ok:        available,
-		Message:   "",
-		StartDate: sd,
-		EndDate:   ed,
-		RoomID:    strconv.Itoa(roomID),
+
+	locale := r.Form.Get("locale")
+	if i18n.Supported(locale) {
+		m.App.Session.Put(r.Context(), "locale", locale)
+	} else {
+		m.App.Session.Put(r.Context(), "error", "unknown language")
 	}
 
-	// I removed the error check, since we handle all aspects of
-	// the json right here
-	out, _ := json.MarshalIndent(resp, "", "     ")
+	http.Redirect(w, r, localReferer(r), http.StatusSeeOther)
+}
+
+// localReferer returns the path of the page the request came from, or "/" when that page is on another site.
+// Paths starting with "//" or "/\\" are refused too, as browsers follow them to another host.
+func localReferer(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || (referer.Host != "" && referer.Host != r.Host) {
+		return "/"
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_, _ = w.Write(out)
+	path := referer.Path
+	if referer.Opaque != "" || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return referer.RequestURI()
 }
+
 func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 	exploded := strings.Split(r.RequestURI, "/")
 	roomID, err := strconv.Atoi(exploded[2])
@@ -330,7 +433,7 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	reservation.StartDate = startDate
 	reservation.EndDate = endDate
 
-	room, err := m.DB.GetRoomByID(reservation.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), reservation.RoomID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't get room from db!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -343,14 +446,13 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "contact", &models.TemplateData{})
+	_ = m.Render.Template(w, r, "contact", &models.TemplateData{})
 }
 
 func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		m.respondError(w, r, http.StatusNotFound, "Can't get reservation from session", "/", http.StatusTemporaryRedirect)
 		return
 	}
 
@@ -359,20 +461,20 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
 
-	sd := reservation.StartDate.Format("2006-01-02")
-	ed := reservation.EndDate.Format("2006-01-02")
+	sd := reservation.StartDate.Format(dateLayout)
+	ed := reservation.EndDate.Format(dateLayout)
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
 
-	_ = render.Template(w, r, "reservation-summary", &models.TemplateData{
+	_ = m.Render.Respond(w, r, http.StatusOK, "reservation-summary", &models.TemplateData{
 		Data:      data,
 		StringMap: stringMap,
 	})
 }
 
 func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "login", &models.TemplateData{
+	_ = m.Render.Template(w, r, "login", &models.TemplateData{
 		Form: forms.New(nil),
 	})
 }
@@ -381,145 +483,1383 @@ func (m *Repository) Login(w http.ResponseWriter, r *http.Request) {
 
 	err := r.ParseForm()
 	if err != nil {
-		log.Println(err)
+		m.App.Logger.WarnContext(r.Context(), "cannot parse form", slog.String("error", err.Error()))
 	}
 
 	form := forms.New(r.PostForm)
 	form.Required("email", "password")
 	form.IsEmail("email")
 	if !form.Valid() {
-		_ = render.Template(w, r, "login", &models.TemplateData{
+		_ = m.Render.Template(w, r, "login", &models.TemplateData{
 			Form: form,
 		})
 		return
 	}
 
-	id, _, err := m.DB.Authenticate(form.Get("email"), form.Get("password"))
+	email := form.Get("email")
+	ip := helpers.ClientIP(r)
+	now := time.Now()
+
+	failures, lastFailure, err := m.DB.FailedLoginsByIP(r.Context(), ip, now.Add(-auth.IPWindow))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+	if wait := auth.IPThrottle.RetryAfter(failures, lastFailure, now); wait > 0 {
+		m.rejectThrottledLogin(w, r, wait)
+		return
+	}
+
+	// unknown emails are only throttled per IP address
+	account, err := m.DB.GetUserByEmail(r.Context(), email)
+	known := err == nil
+	if known {
+		if account.IsLocked(now) {
+			m.rejectThrottledLogin(w, r, account.LockedUntil.Sub(now))
+			return
+		}
+		if wait := auth.AccountThrottle.RetryAfter(account.FailedLogins, account.LastFailedLoginAt, now); wait > 0 {
+			m.rejectThrottledLogin(w, r, wait)
+			return
+		}
+	}
+
+	id, _, err := m.DB.Authenticate(r.Context(), email, form.Get("password"))
 	if err != nil {
-		log.Println(err)
+		m.App.Logger.InfoContext(r.Context(), "failed login", slog.String("error", err.Error()))
+
+		if !known {
+			account = models.User{Email: email}
+		}
+		err = m.recordFailedLogin(r.Context(), account, ip, now)
+		if err != nil {
+			helpers.ServerError(w, r, m.App.Logger, err)
+			return
+		}
+
 		m.App.Session.Put(r.Context(), "error", "invalid login credentials")
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "user_id", id)
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	// the password was right, but the user only gets logged in after entering a code from their device
+	if user.TOTPEnabled {
+		m.App.Session.Put(r.Context(), "two_factor_user_id", user.ID)
+		m.App.Session.Put(r.Context(), "two_factor_started_at", now)
+		http.Redirect(w, r, "/user/login/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	m.completeLogin(w, r, user)
+}
+
+// recordFailedLogin counts a failed attempt against the account, locking it once there are too many,
+// and writes a login event. Accounts with a zero ID are unknown emails and only get the event.
+func (m *Repository) recordFailedLogin(ctx context.Context, account models.User, ip string, now time.Time) error {
+	m.Metrics.FailedLogins.Inc()
+
+	if account.ID > 0 {
+		lockedUntil := auth.AccountThrottle.LockUntil(account.FailedLogins+1, now)
+		err := m.DB.RecordFailedLogin(ctx, account.ID, lockedUntil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.DB.InsertLoginEvent(ctx, models.LoginEvent{UserID: account.ID, Email: account.Email, IPAddress: ip})
+}
+
+// completeLogin puts the user in the session once all login steps have passed
+func (m *Repository) completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	err := m.DB.ResetFailedLogins(r.Context(), user.ID)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+	err = m.DB.InsertLoginEvent(r.Context(), models.LoginEvent{
+		UserID:    user.ID,
+		Email:     user.Email,
+		IPAddress: helpers.ClientIP(r),
+		Success:   true,
+	})
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "user_id", user.ID)
+	m.App.Session.Put(r.Context(), "session_version", user.SessionVersion)
 	m.App.Session.Put(r.Context(), "flash", "logged in successfully")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
-	_ = m.App.Session.Destroy(r.Context())
-	_ = m.App.Session.RenewToken(r.Context())
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+// twoFactorLoginLifetime is how long a correct password stays valid while waiting for the second factor
+const twoFactorLoginLifetime = 5 * time.Minute
+
+// pendingTwoFactorUser returns the user who passed the password step of the login in this session
+func (m *Repository) pendingTwoFactorUser(r *http.Request) (models.User, bool) {
+	id := m.App.Session.GetInt(r.Context(), "two_factor_user_id")
+	started := m.App.Session.GetTime(r.Context(), "two_factor_started_at")
+	if id == 0 || time.Since(started) > twoFactorLoginLifetime {
+		return models.User{}, false
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil || !user.TOTPEnabled {
+		return models.User{}, false
+	}
+
+	return user, true
 }
 
-// ADMIN ROUTES //
+// verifySecondFactor accepts either a current code from the user's authenticator app or an unused recovery code
+func (m *Repository) verifySecondFactor(ctx context.Context, user models.User, code string) bool {
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		return m.DB.UpdateTOTPLastStep(ctx, user.ID, step) == nil
+	}
 
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "admin-dashboard", &models.TemplateData{})
+	return m.DB.UseRecoveryCode(ctx, user.ID, helpers.HashToken(auth.NormalizeRecoveryCode(code))) == nil
 }
 
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
+func (m *Repository) ShowTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	if _, ok := m.pendingTwoFactorUser(r); !ok {
+		m.App.Session.Put(r.Context(), "error", "log in first!")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	_ = m.Render.Template(w, r, "two-factor-login", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+func (m *Repository) PostTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.pendingTwoFactorUser(r)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "log in first!")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		m.App.Logger.WarnContext(r.Context(), "cannot parse form", slog.String("error", err.Error()))
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	if !form.Valid() {
+		_ = m.Render.Template(w, r, "two-factor-login", &models.TemplateData{
+			Form: form,
+		})
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	now := time.Now()
+	if user.IsLocked(now) {
+		m.rejectThrottledLogin(w, r, user.LockedUntil.Sub(now))
+		return
+	}
+	if wait := auth.AccountThrottle.RetryAfter(user.FailedLogins, user.LastFailedLoginAt, now); wait > 0 {
+		m.rejectThrottledLogin(w, r, wait)
+		return
+	}
 
-	_ = render.Template(w, r, "admin-new-reservations", &models.TemplateData{
-		Data: data,
+	if !m.verifySecondFactor(r.Context(), user, form.Get("code")) {
+		err = m.recordFailedLogin(r.Context(), user, helpers.ClientIP(r), now)
+		if err != nil {
+			helpers.ServerError(w, r, m.App.Logger, err)
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "error", "invalid authentication code")
+		http.Redirect(w, r, "/user/login/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), "two_factor_user_id")
+	m.App.Session.Remove(r.Context(), "two_factor_started_at")
+	m.completeLogin(w, r, user)
+}
+
+// rejectThrottledLogin sends the user back to the login form without checking the password
+func (m *Repository) rejectThrottledLogin(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	m.App.Session.Remove(r.Context(), "two_factor_user_id")
+	m.App.Session.Remove(r.Context(), "two_factor_started_at")
+
+	wait = wait.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+
+	m.App.Session.Put(r.Context(), "error", translate(r, "too many failed login attempts, try again in %s", wait))
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+const passwordResetLifetime = time.Hour
+
+func (m *Repository) ShowForgotPassword(w http.ResponseWriter, r *http.Request) {
+	_ = m.Render.Template(w, r, "forgot-password", &models.TemplateData{
+		Form: forms.New(nil),
 	})
 }
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+
+// PostForgotPassword emails a single-use reset link. The response is the same whether or not
+// the address belongs to a user, so the form cannot be used to find out who has an account.
+func (m *Repository) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+	if !form.Valid() {
+		_ = m.Render.Template(w, r, "forgot-password", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
 
-	_ = render.Template(w, r, "admin-all-reservations", &models.TemplateData{
-		Data: data,
-	})
+	user, err := m.DB.GetUserByEmail(r.Context(), form.Get("email"))
+	if err == nil && user.Active {
+		token, tokenHash, err := helpers.NewToken()
+		if err != nil {
+			helpers.ServerError(w, r, m.App.Logger, err)
+			return
+		}
+
+		err = m.DB.InsertPasswordResetToken(r.Context(), user.ID, tokenHash, time.Now().Add(passwordResetLifetime))
+		if err != nil {
+			helpers.ServerError(w, r, m.App.Logger, err)
+			return
+		}
+
+		link := fmt.Sprintf("%s/user/reset-password?token=%s", m.App.BaseURL, token)
+		m.queueMail(r, models.MailData{
+			To:      user.Email,
+			Subject: "Password reset",
+			Content: fmt.Sprintf("Hello %s,\n\nsomeone asked to reset the password of your account. "+
+				"If it was you, open the link below within %d minutes to choose a new password:\n\n%s\n\n"+
+				"If it wasn't you, ignore this email and your password will stay the same.\n",
+				user.FirstName, int(passwordResetLifetime.Minutes()), link),
+		})
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "If the address belongs to an account, a reset link is on its way")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
-func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
-	_ = render.Template(w, r, "admin-reservations-calendar", &models.TemplateData{})
+
+// queueMail hands msg to the mail sender without waiting. When the queue is full the message is
+// dropped and logged, so a slow mail server cannot hold up requests.
+func (m *Repository) queueMail(r *http.Request, msg models.MailData) {
+	select {
+	case m.App.MailChan <- msg:
+	default:
+		m.App.Logger.ErrorContext(r.Context(), "mail queue is full, dropping mail",
+			slog.String("to", msg.To), slog.String("subject", msg.Subject))
+	}
 }
 
-func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
-	splitted := strings.Split(r.RequestURI, "/")
-	src := splitted[3]
-	id, err := strconv.Atoi(splitted[4])
+func (m *Repository) ShowResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	_, err := m.DB.PasswordResetTokenUserID(r.Context(), helpers.HashToken(token))
 	if err != nil {
-		helpers.ServerError(w, err)
+		m.App.Session.Put(r.Context(), "error", "reset link is invalid or has expired")
+		http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
 		return
 	}
 
 	stringMap := make(map[string]string)
-	stringMap["src"] = src
-
-	reservation, err := m.DB.GetReservationByID(id)
-
-	data := make(map[string]interface{})
-	data["reservation"] = reservation
+	stringMap["token"] = token
 
-	_ = render.Template(w, r, "admin-reservations-show", &models.TemplateData{
+	_ = m.Render.Template(w, r, "reset-password", &models.TemplateData{
 		StringMap: stringMap,
-		Data:      data,
 		Form:      forms.New(nil),
 	})
 }
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	_ = m.DB.UpdateProcessedForReservation(id, 1)
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
-
-	src := chi.URLParam(r, "src")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-}
-func (m *Repository) AdminPostReservation(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) PostResetPassword(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
 		return
 	}
 
-	splitted := strings.Split(r.RequestURI, "/")
-	src := splitted[3]
-	id, err := strconv.Atoi(splitted[4])
-	if err != nil {
-		helpers.ServerError(w, err)
+	form := forms.New(r.PostForm)
+	form.Required("token", "password", "password_confirm")
+	form.StrongPassword("password")
+	form.Matches("password_confirm", "password")
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["token"] = form.Get("token")
+
+		_ = m.Render.Template(w, r, "reset-password", &models.TemplateData{
+			StringMap: stringMap,
+			Form:      form,
+		})
 		return
 	}
 
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
-
-	reservation, err := m.DB.GetReservationByID(id)
-	reservation.FirstName = r.Form.Get("first_name")
-	reservation.LastName = r.Form.Get("last_name")
-	reservation.Email = r.Form.Get("email")
-	reservation.Phone = r.Form.Get("phone")
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(form.Get("password")), 12)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
 
-	err = m.DB.UpdateReservation(reservation)
+	_, err = m.DB.ResetPassword(r.Context(), helpers.HashToken(form.Get("token")), string(hashedPassword))
 	if err != nil {
-		helpers.ServerError(w, err)
+		m.App.Session.Put(r.Context(), "error", "reset link is invalid or has expired")
+		http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "Changes saved")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Remove(r.Context(), "user_id")
+	m.App.Session.Put(r.Context(), "flash", "Password changed, please log in")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
-func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	_ = m.DB.DeleteReservation(id)
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
 
-	src := chi.URLParam(r, "src")
+func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.Destroy(r.Context())
+	_ = m.App.Session.RenewToken(r.Context())
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// currentUser returns the logged-in user, redirecting to the login form if there is none
+func (m *Repository) currentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	user, ok := helpers.CurrentUser(r)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "log in first!")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	}
+	return user, ok
+}
+
+// totpIssuer is the name authenticator apps show next to the account
+const totpIssuer = "Booking App"
+
+// recoveryCodeCount is how many recovery codes are issued when two-factor login is enabled
+const recoveryCodeCount = 10
+
+// ShowTwoFactor shows the two-factor settings of the logged-in user, starting an enrollment if it is off
+func (m *Repository) ShowTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["enabled"] = user.TOTPEnabled
+
+	if !user.TOTPEnabled {
+		// keep the pending secret across reloads, so a device that already scanned it stays valid
+		if user.TOTPSecret == "" {
+			var err error
+			user.TOTPSecret, err = auth.NewTOTPSecret()
+			if err != nil {
+				helpers.ServerError(w, r, m.App.Logger, err)
+				return
+			}
+
+			err = m.DB.SetTOTPSecret(r.Context(), user.ID, user.TOTPSecret)
+			if err != nil {
+				helpers.ServerError(w, r, m.App.Logger, err)
+				return
+			}
+		}
+
+		data["secret"] = user.TOTPSecret
+		data["uri"] = auth.TOTPURI(totpIssuer, user.Email, user.TOTPSecret)
+	}
+
+	_ = m.Render.Template(w, r, "two-factor", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// PostTwoFactor finishes an enrollment with a code from the user's device and shows the recovery codes once
+func (m *Repository) PostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, form.Get("code"), time.Now(), 0)
+	if form.Valid() && !ok {
+		form.Errors.Add("code", "Invalid code, check that the clock of your device is correct")
+	}
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["enabled"] = false
+		data["secret"] = user.TOTPSecret
+		data["uri"] = auth.TOTPURI(totpIssuer, user.Email, user.TOTPSecret)
+
+		_ = m.Render.Template(w, r, "two-factor", &models.TemplateData{
+			Data: data,
+			Form: form,
+		})
+		return
+	}
+
+	codes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = helpers.HashToken(code)
+	}
+
+	err = m.DB.EnableTOTP(r.Context(), user.ID, step, hashes)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["codes"] = codes
+
+	m.App.Session.Put(r.Context(), "flash", "Two-factor login enabled")
+	_ = m.Render.Template(w, r, "two-factor-recovery-codes", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostDisableTwoFactor turns two-factor login off after checking a current code or a recovery code
+func (m *Repository) PostDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if m.App.RequireManagerTwoFactor && user.IsManager() {
+		m.App.Session.Put(r.Context(), "error", "two-factor login is required for managers")
+		http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	if !user.TOTPEnabled || !m.verifySecondFactor(r.Context(), user, r.Form.Get("code")) {
+		m.App.Session.Put(r.Context(), "error", "invalid authentication code")
+		http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.DisableTOTP(r.Context(), user.ID)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Two-factor login disabled")
+	http.Redirect(w, r, "/user/two-factor", http.StatusSeeOther)
+}
+
+// emailTaken reports whether another user than userID already has the email address
+func (m *Repository) emailTaken(ctx context.Context, email string, userID int) bool {
+	existing, err := m.DB.GetUserByEmail(ctx, email)
+	return err == nil && existing.ID != userID
+}
+
+// userFromForm copies the editable profile fields from the form onto user
+func userFromForm(user models.User, form *forms.Form) models.User {
+	user.FirstName = form.Get("first_name")
+	user.LastName = form.Get("last_name")
+	user.Email = form.Get("email")
+	return user
+}
+
+func (m *Repository) ShowProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["user"] = user
+
+	_ = m.Render.Template(w, r, "profile", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// PostProfile lets users change their own name and email address, but not their access level
+func (m *Repository) PostProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email")
+	form.IsEmail("email")
+	if form.Valid() && m.emailTaken(r.Context(), form.Get("email"), user.ID) {
+		form.Errors.Add("email", "This email address is already in use")
+	}
+
+	user = userFromForm(user, form)
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["user"] = user
+
+		_ = m.Render.Template(w, r, "profile", &models.TemplateData{
+			Data: data,
+			Form: form,
+		})
+		return
+	}
+
+	err = m.DB.UpdateUser(r.Context(), user)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Profile saved")
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+func (m *Repository) ShowChangePassword(w http.ResponseWriter, r *http.Request) {
+	_ = m.Render.Template(w, r, "change-password", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostChangePassword sets a new password after checking the current one. Other sessions of the user end,
+// the current one stays logged in.
+func (m *Repository) PostChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("current_password", "password", "password_confirm")
+	form.StrongPassword("password")
+	form.Matches("password_confirm", "password")
+	if form.Valid() {
+		_, _, err = m.DB.Authenticate(r.Context(), user.Email, form.Get("current_password"))
+		if err != nil {
+			form.Errors.Add("current_password", "Incorrect password")
+		}
+	}
+	if !form.Valid() {
+		_ = m.Render.Template(w, r, "change-password", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(form.Get("password")), 12)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	sessionVersion, err := m.DB.UpdatePassword(r.Context(), user.ID, string(hashedPassword))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "session_version", sessionVersion)
+	m.App.Session.Put(r.Context(), "flash", "Password changed")
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// ADMIN ROUTES //
+
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	stats, err := m.DB.DashboardStats(r.Context(), today)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	moving, err := m.DB.ReservationsArrivingOrDeparting(r.Context(), today)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	var arrivals, departures []models.Reservation
+	for _, reservation := range moving {
+		if reservation.StartDate.Equal(today) {
+			arrivals = append(arrivals, reservation)
+		} else {
+			departures = append(departures, reservation)
+		}
+	}
+
+	pastOccupancy, err := m.DB.RoomOccupancy(r.Context(), today.AddDate(0, 0, -30), today)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	nextOccupancy, err := m.DB.RoomOccupancy(r.Context(), today, today.AddDate(0, 0, 30))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	thisMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	revenue, err := m.DB.MonthlyRevenue(r.Context(), thisMonth.AddDate(0, -11, 0), thisMonth.AddDate(0, 1, 0))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	var revenueLabels, revenueAmounts []string
+	for _, month := range revenue {
+		revenueLabels = append(revenueLabels, month.Label())
+		revenueAmounts = append(revenueAmounts, month.Amount())
+	}
+
+	data := make(map[string]interface{})
+	data["stats"] = stats
+	data["arrivals"] = arrivals
+	data["departures"] = departures
+	data["pastOccupancy"] = pastOccupancy
+	data["nextOccupancy"] = nextOccupancy
+	data["revenueLabels"] = revenueLabels
+	data["revenueAmounts"] = revenueAmounts
+
+	_ = m.Render.Template(w, r, "admin-dashboard", &models.TemplateData{
+		Data: data,
+	})
+}
+
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	m.adminReservationList(w, r, "admin-new-reservations", models.ReservationStatusNew)
+}
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	m.adminReservationList(w, r, "admin-all-reservations", "")
+}
+
+// adminReservationList renders one page of reservations filtered, sorted and paged by the query string.
+// A non-empty status overrides the status filter from the query.
+func (m *Repository) adminReservationList(w http.ResponseWriter, r *http.Request, page, status string) {
+	query, err := reservationQueryFromRequest(r)
+	if err != nil {
+		m.respondError(w, r, http.StatusBadRequest, translate(r, "invalid filter: %s", err), r.URL.Path, http.StatusSeeOther)
+		return
+	}
+	if status != "" {
+		query.Status = status
+	}
+
+	reservations, total, err := m.DB.ListReservations(r.Context(), query)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	queryParams := r.URL.Query()
+	stringMap := make(map[string]string)
+	for _, key := range []string{"start", "end", "room_id", "status", "q"} {
+		stringMap[key] = queryParams.Get(key)
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	data["rooms"] = rooms
+	data["pagination"] = models.NewPagination(r.URL.Path, queryParams, query, total)
+	data["statusFilter"] = status == ""
+
+	_ = m.Render.Respond(w, r, http.StatusOK, page, &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+const defaultPageSize = 20
+const maxPageSize = 100
+
+// reservationQueryFromRequest reads the filter plus the page, per_page, sort and dir query parameters
+func reservationQueryFromRequest(r *http.Request) (models.ReservationQuery, error) {
+	query := models.ReservationQuery{
+		Page:      1,
+		PageSize:  defaultPageSize,
+		Sort:      "start_date",
+		Direction: models.SortAsc,
+	}
+
+	filter, err := reservationFilterFromQuery(r)
+	if err != nil {
+		return query, err
+	}
+	query.ReservationFilter = filter
+
+	queryParams := r.URL.Query()
+	if page := queryParams.Get("page"); page != "" {
+		query.Page, err = strconv.Atoi(page)
+		if err != nil || query.Page < 1 {
+			return query, fmt.Errorf("invalid page '%s'", page)
+		}
+	}
+	if perPage := queryParams.Get("per_page"); perPage != "" {
+		query.PageSize, err = strconv.Atoi(perPage)
+		if err != nil || query.PageSize < 1 || query.PageSize > maxPageSize {
+			return query, fmt.Errorf("invalid page size '%s'", perPage)
+		}
+	}
+
+	switch sort := queryParams.Get("sort"); sort {
+	case "":
+	case "id", "last_name", "room", "start_date", "end_date", "created_at":
+		query.Sort = sort
+	default:
+		return query, fmt.Errorf("cannot sort by '%s'", sort)
+	}
+
+	switch direction := queryParams.Get("dir"); direction {
+	case "":
+	case models.SortAsc, models.SortDesc:
+		query.Direction = direction
+	default:
+		return query, fmt.Errorf("invalid sort direction '%s'", direction)
+	}
+
+	return query, nil
+}
+
+const searchResultsLimit = 50
+
+// AdminSearch finds reservations by guest name, email, phone or confirmation code,
+// grouped into upcoming, current and past stays
+func (m *Repository) AdminSearch(w http.ResponseWriter, r *http.Request) {
+	term := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	reservations, err := m.DB.SearchReservations(r.Context(), term, searchResultsLimit)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	upcoming, current, past := []models.Reservation{}, []models.Reservation{}, []models.Reservation{}
+	// stays are stored as UTC dates, as on the dashboard
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, reservation := range reservations {
+		switch {
+		case reservation.StartDate.After(today):
+			upcoming = append(upcoming, reservation)
+		case reservation.EndDate.After(today):
+			current = append(current, reservation)
+		default:
+			past = append(past, reservation)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["q"] = term
+	data["total"] = len(reservations)
+	data["upcoming"] = upcoming
+	data["current"] = current
+	data["past"] = past
+
+	_ = m.Render.Respond(w, r, http.StatusOK, "admin-search", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// reservationFilterFromQuery reads the start, end, room_id, status and q query parameters
+func reservationFilterFromQuery(r *http.Request) (models.ReservationFilter, error) {
+	var filter models.ReservationFilter
+	var err error
+	queryParams := r.URL.Query()
+
+	layout := "2006-01-02"
+	if start := queryParams.Get("start"); start != "" {
+		filter.StartDate, err = time.Parse(layout, start)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if end := queryParams.Get("end"); end != "" {
+		filter.EndDate, err = time.Parse(layout, end)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if roomID := queryParams.Get("room_id"); roomID != "" {
+		filter.RoomID, err = strconv.Atoi(roomID)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	filter.Search = strings.TrimSpace(queryParams.Get("q"))
+
+	switch status := queryParams.Get("status"); status {
+	case "", models.ReservationStatusNew, models.ReservationStatusProcessed:
+		filter.Status = status
+	default:
+		return filter, fmt.Errorf("unknown status '%s'", status)
+	}
+
+	return filter, nil
+}
+
+// csvCell keeps text typed in by guests from being run as a formula when the export is opened
+// in a spreadsheet: cells starting with a formula character get a leading quote
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// AdminExportReservations streams reservations as a CSV file that Excel opens as UTF-8
+func (m *Repository) AdminExportReservations(w http.ResponseWriter, r *http.Request) {
+	filter, err := reservationFilterFromQuery(r)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "invalid export filter")
+		http.Redirect(w, r, "/admin/reservations-all", http.StatusSeeOther)
+		return
+	}
+
+	filename := fmt.Sprintf("reservations-%s.csv", time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// the byte order mark makes Excel detect UTF-8 instead of the local code page
+	_, _ = w.Write([]byte("\uFEFF"))
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"ID", "Confirmation Code", "First Name", "Last Name", "Email", "Phone", "Room",
+		"Arrival", "Departure", "Nights", "Status", "Created At"})
+
+	err = m.DB.EachReservation(r.Context(), filter, func(reservation models.Reservation) error {
+		status := models.ReservationStatusNew
+		if reservation.Processed == 1 {
+			status = models.ReservationStatusProcessed
+		}
+
+		nights := int(reservation.EndDate.Sub(reservation.StartDate).Hours() / 24)
+
+		return writer.Write([]string{
+			strconv.Itoa(reservation.ID),
+			csvCell(reservation.ConfirmationCode),
+			csvCell(reservation.FirstName),
+			csvCell(reservation.LastName),
+			csvCell(reservation.Email),
+			csvCell(reservation.Phone),
+			csvCell(reservation.Room.RoomName),
+			reservation.StartDate.Format(dateLayout),
+			reservation.EndDate.Format(dateLayout),
+			strconv.Itoa(nights),
+			status,
+			reservation.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	})
+
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		// headers are already sent, so the best we can do is log and cut the file short
+		m.App.Logger.ErrorContext(r.Context(), "reservation export failed", slog.String("error", err.Error()))
+	}
+}
+func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	_ = m.Render.Template(w, r, "admin-reservations-calendar", &models.TemplateData{})
+}
+
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.RequestURI, "/")
+	src := splitted[3]
+	id, err := strconv.Atoi(splitted[4])
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	reservation, err := m.DB.GetReservationByID(r.Context(), id)
+
+	data := make(map[string]interface{})
+	data["reservation"] = reservation
+
+	_ = m.Render.Template(w, r, "admin-reservations-show", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	_ = m.DB.UpdateProcessedForReservation(r.Context(), id, 1)
+	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+
+	src := chi.URLParam(r, "src")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+func (m *Repository) AdminPostReservation(w http.ResponseWriter, r *http.Request) {
+	splitted := strings.Split(r.RequestURI, "/")
+	src := splitted[3]
+	id, err := strconv.Atoi(splitted[4])
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	var input guestInput
+	form, err := forms.BindRequest(r, &input)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	reservation, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+	reservation.FirstName = input.FirstName
+	reservation.LastName = input.LastName
+	reservation.Email = input.Email
+	reservation.Phone = input.Phone
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["reservation"] = reservation
+
+		_ = m.Render.Template(w, r, "admin-reservations-show", &models.TemplateData{
+			StringMap: stringMap,
+			Data:      data,
+			Form:      form,
+		})
+		return
+	}
+
+	err = m.DB.UpdateReservation(r.Context(), reservation)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	_ = m.DB.DeleteReservation(r.Context(), id)
+	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+
+	src := chi.URLParam(r, "src")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 }
+
+func (m *Repository) AdminICalFeeds(w http.ResponseWriter, r *http.Request) {
+	feeds, err := m.DB.AllICalFeeds(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	logs := make(map[int][]models.ICalSyncLog)
+	for _, feed := range feeds {
+		feedLogs, err := m.DB.ICalSyncLogsByFeedID(r.Context(), feed.ID, 5)
+		if err != nil {
+			helpers.ServerError(w, r, m.App.Logger, err)
+			return
+		}
+		logs[feed.ID] = feedLogs
+	}
+
+	data := make(map[string]interface{})
+	data["feeds"] = feeds
+	data["rooms"] = rooms
+	data["logs"] = logs
+
+	_ = m.Render.Template(w, r, "admin-ical-feeds", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+func (m *Repository) AdminPostICalFeed(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "url")
+	form.IsURL("url")
+
+	roomID, err := strconv.Atoi(form.Get("room_id"))
+	if err != nil {
+		form.Errors.Add("room_id", "Choose a room")
+	}
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", translate(r, "invalid feed: %s", form.Errors.Get("url")+form.Errors.Get("room_id")))
+		http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+		return
+	}
+
+	_, err = m.DB.InsertICalFeed(r.Context(), models.RoomICalFeed{
+		RoomID: roomID,
+		URL:    form.Get("url"),
+	})
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Feed added")
+	http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+}
+func (m *Repository) AdminDeleteICalFeed(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	_ = m.DB.DeleteICalFeed(r.Context(), id)
+	m.App.Session.Put(r.Context(), "flash", "Feed deleted")
+	http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+}
+func (m *Repository) AdminSyncICalFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	feed, err := m.DB.GetICalFeedByID(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot find feed")
+		http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+		return
+	}
+
+	result, err := ical.NewSyncer(m.App, m.DB).SyncFeed(r.Context(), feed)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", translate(r, "sync failed: %s", err))
+		http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", translate(r, "Feed synced: %d added, %d updated, %d removed",
+		result.Added, result.Updated, result.Removed))
+	http.Redirect(w, r, "/admin/ical-feeds", http.StatusSeeOther)
+}
+
+// loginEventsLimit is how many recent login attempts the login activity page shows
+const loginEventsLimit = 100
+
+// AdminLoginActivity shows locked accounts and the most recent login attempts
+func (m *Repository) AdminLoginActivity(w http.ResponseWriter, r *http.Request) {
+	locked, err := m.DB.LockedUsers(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	events, err := m.DB.RecentLoginEvents(r.Context(), loginEventsLimit)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["locked"] = locked
+	data["events"] = events
+
+	_ = m.Render.Template(w, r, "admin-login-activity", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminUnlockUser lifts a lockout and clears the failed login count of a user
+func (m *Repository) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	err = m.DB.ResetFailedLogins(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Account unlocked")
+	http.Redirect(w, r, "/admin/login-activity", http.StatusSeeOther)
+}
+
+// invitationLifetime is how long the link in an invitation email can be used to choose a password
+const invitationLifetime = 72 * time.Hour
+
+func (m *Repository) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := m.DB.ListUsers(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["users"] = users
+
+	_ = m.Render.Respond(w, r, http.StatusOK, "admin-users", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// userFormValid checks the fields an administrator can set on a user
+func (m *Repository) userFormValid(ctx context.Context, form *forms.Form, userID int) bool {
+	form.Required("first_name", "last_name", "email", "access_level")
+	form.IsEmail("email")
+
+	level, _ := strconv.Atoi(form.Get("access_level"))
+	if _, ok := models.AccessLevelNames[level]; !ok && form.Has("access_level") {
+		form.Errors.Add("access_level", "Unknown access level")
+	}
+
+	if form.Valid() && m.emailTaken(ctx, form.Get("email"), userID) {
+		form.Errors.Add("email", "This email address is already in use")
+	}
+
+	return form.Valid()
+}
+
+// renderUserForm shows the user form, for a new user when user.ID is zero
+func (m *Repository) renderUserForm(w http.ResponseWriter, r *http.Request, user models.User, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["user"] = user
+	data["levels"] = models.AccessLevelNames
+
+	_ = m.Render.Template(w, r, "admin-user", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+func (m *Repository) AdminInviteUser(w http.ResponseWriter, r *http.Request) {
+	m.renderUserForm(w, r, models.User{AccessLevel: models.AccessLevelStaff}, forms.New(nil))
+}
+
+// AdminPostInviteUser creates a user without a usable password and emails them a link to choose one
+func (m *Repository) AdminPostInviteUser(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	user := userFromForm(models.User{}, form)
+	user.AccessLevel, _ = strconv.Atoi(form.Get("access_level"))
+	if !m.userFormValid(r.Context(), form, 0) {
+		m.renderUserForm(w, r, user, form)
+		return
+	}
+
+	// nobody knows this password; the user sets their own through the invitation link
+	placeholder, _, err := helpers.NewToken()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(placeholder), 12)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+	user.Password = string(hashedPassword)
+
+	user.ID, err = m.DB.InsertUser(r.Context(), user)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	token, tokenHash, err := helpers.NewToken()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	err = m.DB.InsertPasswordResetToken(r.Context(), user.ID, tokenHash, time.Now().Add(invitationLifetime))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/user/reset-password?token=%s", m.App.BaseURL, token)
+	m.queueMail(r, models.MailData{
+		To:      user.Email,
+		Subject: "Your account",
+		Content: fmt.Sprintf("Hello %s,\n\nan account was created for you. "+
+			"Open the link below within %d hours to choose your password:\n\n%s\n",
+			user.FirstName, int(invitationLifetime.Hours()), link),
+	})
+
+	m.App.Session.Put(r.Context(), "flash", translate(r, "Invitation sent to %s", user.Email))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (m *Repository) AdminShowUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot find user")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	m.renderUserForm(w, r, user, forms.New(nil))
+}
+
+func (m *Repository) AdminPostUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot find user")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	user = userFromForm(user, form)
+	user.AccessLevel, _ = strconv.Atoi(form.Get("access_level"))
+
+	valid := m.userFormValid(r.Context(), form, user.ID)
+	if current, _ := helpers.CurrentUser(r); valid && user.ID == current.ID && !user.IsAdmin() {
+		form.Errors.Add("access_level", "You cannot remove your own administrator rights")
+		valid = false
+	}
+	if !valid {
+		m.renderUserForm(w, r, user, form)
+		return
+	}
+
+	err = m.DB.UpdateUser(r.Context(), user)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "User saved")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (m *Repository) AdminDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	m.setUserActive(w, r, false)
+}
+
+func (m *Repository) AdminActivateUser(w http.ResponseWriter, r *http.Request) {
+	m.setUserActive(w, r, true)
+}
+
+func (m *Repository) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	if current, _ := helpers.CurrentUser(r); !active && id == current.ID {
+		m.App.Session.Put(r.Context(), "error", "you cannot deactivate your own account")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.SetUserActive(r.Context(), id, active)
+	if err != nil {
+		helpers.ServerError(w, r, m.App.Logger, err)
+		return
+	}
+
+	if active {
+		m.App.Session.Put(r.Context(), "flash", "User activated")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "User deactivated")
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"github.com/Sunpacker/go-booking-app/internal/auth"
 	"github.com/Sunpacker/go-booking-app/internal/driver"
+	"github.com/Sunpacker/go-booking-app/internal/helpers"
+	"github.com/Sunpacker/go-booking-app/internal/i18n"
 	"github.com/Sunpacker/go-booking-app/internal/models"
 	"log"
 	"net/http"
@@ -12,6 +16,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var theTests = []struct {
@@ -62,7 +67,7 @@ func TestRepository_Reservation(t *testing.T) {
 	rr := httptest.NewRecorder()
 	session.Put(ctx, "reservation", reservation)
 
-	handler := http.HandlerFunc(Repo.Reservation)
+	handler := http.HandlerFunc(repo.Reservation)
 
 	handler.ServeHTTP(rr, req)
 
@@ -103,6 +108,7 @@ var postReservationTests = []struct {
 	expectedResponseCode int
 	expectedLocation     string
 	expectedHTML         string
+	brokenDB             bool
 }{
 	{
 		name: "valid-data",
@@ -122,7 +128,7 @@ var postReservationTests = []struct {
 	{
 		name:                 "missing-post-body",
 		postedData:           nil,
-		expectedResponseCode: http.StatusSeeOther,
+		expectedResponseCode: http.StatusTemporaryRedirect,
 		expectedHTML:         "",
 		expectedLocation:     "/",
 	},
@@ -183,7 +189,37 @@ var postReservationTests = []struct {
 			"room_id":    {"1"},
 		},
 		expectedResponseCode: http.StatusOK,
-		expectedHTML:         `action="/make-reservation"`,
+		expectedHTML:         `value="J"`,
+		expectedLocation:     "",
+	},
+	{
+		name: "departure-before-arrival",
+		postedData: url.Values{
+			"start_date": {"2050-01-05"},
+			"end_date":   {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+			"room_id":    {"1"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "The end date must be after the start date",
+		expectedLocation:     "",
+	},
+	{
+		name: "invalid-phone",
+		postedData: url.Values{
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"call me"},
+			"room_id":    {"1"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "Invalid phone number",
 		expectedLocation:     "",
 	},
 	{
@@ -195,9 +231,9 @@ var postReservationTests = []struct {
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
 			"phone":      {"555-555-5555"},
-			"room_id":    {"2"},
+			"room_id":    {"1000"},
 		},
-		expectedResponseCode: http.StatusSeeOther,
+		expectedResponseCode: http.StatusTemporaryRedirect,
 		expectedHTML:         "",
 		expectedLocation:     "/",
 	},
@@ -210,9 +246,10 @@ var postReservationTests = []struct {
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
 			"phone":      {"555-555-5555"},
-			"room_id":    {"1000"},
+			"room_id":    {"1"},
 		},
-		expectedResponseCode: http.StatusSeeOther,
+		brokenDB:             true,
+		expectedResponseCode: http.StatusTemporaryRedirect,
 		expectedHTML:         "",
 		expectedLocation:     "/",
 	},
@@ -232,8 +269,13 @@ func TestPostReservation(t *testing.T) {
 		req = req.WithContext(ctx)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
+		handlers := repo
+		if e.brokenDB {
+			handlers = newBrokenRepo()
+		}
+
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(Repo.PostReservation)
+		handler := http.HandlerFunc(handlers.PostReservation)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedResponseCode {
@@ -272,14 +314,15 @@ func TestNewRepo(t *testing.T) {
 var testPostAvailabilityData = []struct {
 	name               string
 	postedData         url.Values
+	brokenDB           bool
 	expectedStatusCode int
 	expectedLocation   string
 }{
 	{
 		name: "rooms not available",
 		postedData: url.Values{
-			"start": {"2050-01-01"},
-			"end":   {"2050-01-02"},
+			"start": {testBookedFrom},
+			"end":   {testBookedUntil},
 		},
 		expectedStatusCode: http.StatusSeeOther,
 	},
@@ -295,7 +338,7 @@ var testPostAvailabilityData = []struct {
 	{
 		name:               "empty post body",
 		postedData:         url.Values{},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusTemporaryRedirect,
 	},
 	{
 		name: "start date wrong format",
@@ -304,7 +347,7 @@ var testPostAvailabilityData = []struct {
 			"end":     {"2040-01-02"},
 			"room_id": {"1"},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusTemporaryRedirect,
 	},
 	{
 		name: "end date wrong format",
@@ -312,7 +355,7 @@ var testPostAvailabilityData = []struct {
 			"start": {"2040-01-01"},
 			"end":   {"invalid"},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusTemporaryRedirect,
 	},
 	{
 		name: "database query fails",
@@ -320,7 +363,8 @@ var testPostAvailabilityData = []struct {
 			"start": {"2060-01-01"},
 			"end":   {"2060-01-02"},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		brokenDB:           true,
+		expectedStatusCode: http.StatusTemporaryRedirect,
 	},
 }
 
@@ -337,8 +381,13 @@ func TestPostAvailability(t *testing.T) {
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
 
+		handlers := repo
+		if e.brokenDB {
+			handlers = newBrokenRepo()
+		}
+
 		// make our handler a http.HandlerFunc and call
-		handler := http.HandlerFunc(Repo.PostAvailability)
+		handler := http.HandlerFunc(handlers.PostAvailability)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedStatusCode {
@@ -347,35 +396,50 @@ func TestPostAvailability(t *testing.T) {
 	}
 }
 
-// testAvailabilityJSONData is data for the AvailabilityJSON handler, /search-availability-json route
-var testAvailabilityJSONData = []struct {
-	name            string
-	postedData      url.Values
-	expectedOK      bool
-	expectedMessage string
+// testRoomAvailabilityData is data for the PostAvailability handler checking one room for JSON clients,
+// as the room pages do
+var testRoomAvailabilityData = []struct {
+	name               string
+	postedData         url.Values
+	brokenDB           bool
+	expectedStatusCode int
+	expectedOK         bool
 }{
 	{
-		name: "rooms not available",
+		name: "room not available",
 		postedData: url.Values{
-			"start":   {"2050-01-01"},
-			"end":     {"2050-01-02"},
+			"start":   {testBookedFrom},
+			"end":     {testBookedUntil},
 			"room_id": {"1"},
 		},
-		expectedOK: false,
-	}, {
-		name: "rooms are available",
+		expectedStatusCode: http.StatusOK,
+		expectedOK:         false,
+	},
+	{
+		name: "room is available",
 		postedData: url.Values{
 			"start":   {"2040-01-01"},
 			"end":     {"2040-01-02"},
 			"room_id": {"1"},
 		},
-		expectedOK: true,
+		expectedStatusCode: http.StatusOK,
+		expectedOK:         true,
 	},
 	{
-		name:            "empty post body",
-		postedData:      nil,
-		expectedOK:      false,
-		expectedMessage: "Internal Server Error",
+		name: "unknown room",
+		postedData: url.Values{
+			"start":   {"2040-01-01"},
+			"end":     {"2040-01-02"},
+			"room_id": {"100"},
+		},
+		expectedStatusCode: http.StatusNotFound,
+		expectedOK:         false,
+	},
+	{
+		name:               "empty post body",
+		postedData:         nil,
+		expectedStatusCode: http.StatusBadRequest,
+		expectedOK:         false,
 	},
 	{
 		name: "database query fails",
@@ -384,39 +448,61 @@ var testAvailabilityJSONData = []struct {
 			"end":     {"2060-01-02"},
 			"room_id": {"1"},
 		},
-		expectedOK:      false,
-		expectedMessage: "Error querying database",
+		brokenDB:           true,
+		expectedStatusCode: http.StatusInternalServerError,
+		expectedOK:         false,
 	},
 }
 
-// TestAvailabilityJSON tests the AvailabilityJSON handler
-func TestAvailabilityJSON(t *testing.T) {
-	for _, e := range testAvailabilityJSONData {
+// TestPostAvailability_Room tests the search for one room that the room pages send
+func TestPostAvailability_Room(t *testing.T) {
+	for _, e := range testRoomAvailabilityData {
 		// create request, get the context with session, set header, create recorder
 		var req *http.Request
 		if e.postedData != nil {
-			req, _ = http.NewRequest("POST", "/search-availability-json", strings.NewReader(e.postedData.Encode()))
+			req, _ = http.NewRequest("POST", "/search-availability", strings.NewReader(e.postedData.Encode()))
 		} else {
-			req, _ = http.NewRequest("POST", "/search-availability-json", nil)
+			req, _ = http.NewRequest("POST", "/search-availability", nil)
 		}
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
 		rr := httptest.NewRecorder()
 
+		handlers := repo
+		if e.brokenDB {
+			handlers = newBrokenRepo()
+		}
+
 		// make our handler a http.HandlerFunc and call
-		handler := http.HandlerFunc(Repo.AvailabilityJSON)
+		handler := http.HandlerFunc(handlers.PostAvailability)
 		handler.ServeHTTP(rr, req)
 
-		var j jsonResponse
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s gave wrong status code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		// errors are negotiated too, so every answer depends on the Accept header
+		if vary := rr.Header().Get("Vary"); vary != "Accept" {
+			t.Errorf("%s: expected the response to vary on Accept, got '%s'", e.name, vary)
+		}
+
+		var j struct {
+			Ok     bool          `json:"ok"`
+			RoomID int           `json:"room_id"`
+			Rooms  []models.Room `json:"rooms"`
+		}
 		err := json.Unmarshal([]byte(rr.Body.String()), &j)
 		if err != nil {
-			t.Error("failed to parse json!")
+			t.Errorf("%s: failed to parse json!", e.name)
 		}
 
 		if j.Ok != e.expectedOK {
 			t.Errorf("%s: expected %v but got %v", e.name, e.expectedOK, j.Ok)
 		}
+		if e.expectedOK && (j.RoomID != 1 || len(j.Rooms) != 1 || j.Rooms[0].ID != 1) {
+			t.Errorf("%s: expected only room 1 in %s", e.name, rr.Body.String())
+		}
 	}
 }
 
@@ -445,7 +531,7 @@ var reservationSummaryTests = []struct {
 		name:               "res-not-in-session",
 		reservation:        models.Reservation{},
 		url:                "/reservation-summary",
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusTemporaryRedirect,
 		expectedLocation:   "/",
 	},
 }
@@ -462,7 +548,7 @@ func TestReservationSummary(t *testing.T) {
 			session.Put(ctx, "reservation", e.reservation)
 		}
 
-		handler := http.HandlerFunc(Repo.ReservationSummary)
+		handler := http.HandlerFunc(repo.ReservationSummary)
 
 		handler.ServeHTTP(rr, req)
 
@@ -479,6 +565,182 @@ func TestReservationSummary(t *testing.T) {
 	}
 }
 
+// jsonResponseTests is the data for the handlers answering JSON clients
+var jsonResponseTests = []struct {
+	name               string
+	method             string
+	url                string
+	postedData         url.Values
+	body               string
+	reservation        models.Reservation
+	handler            func(*Repository, http.ResponseWriter, *http.Request)
+	expectedStatusCode int
+	expectedInBody     string
+}{
+	{
+		name:               "availability-no-rooms",
+		method:             "POST",
+		url:                "/search-availability",
+		postedData:         url.Values{"start": {testBookedFrom}, "end": {testBookedUntil}},
+		handler:            (*Repository).PostAvailability,
+		expectedStatusCode: http.StatusOK,
+		expectedInBody:     `"rooms": []`,
+	},
+	{
+		name:               "availability-invalid-date",
+		method:             "POST",
+		url:                "/search-availability",
+		postedData:         url.Values{"start": {"invalid"}, "end": {"2050-01-02"}},
+		handler:            (*Repository).PostAvailability,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedInBody:     `"code": "date"`,
+	},
+	{
+		name:               "availability-json-body",
+		method:             "POST",
+		url:                "/search-availability",
+		body:               `{"start": "2050-01-05", "end": "2050-01-01"}`,
+		handler:            (*Repository).PostAvailability,
+		expectedStatusCode: http.StatusUnprocessableEntity,
+		expectedInBody:     `"code": "date_order"`,
+	},
+	{
+		name:   "summary-in-session",
+		method: "GET",
+		url:    "/reservation-summary",
+		reservation: models.Reservation{
+			RoomID:           1,
+			ConfirmationCode: "ABC123",
+			StartDate:        time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		handler:            (*Repository).ReservationSummary,
+		expectedStatusCode: http.StatusOK,
+		expectedInBody:     `"start_date": "2050-01-01"`,
+	},
+	{
+		name:               "summary-not-in-session",
+		method:             "GET",
+		url:                "/reservation-summary",
+		handler:            (*Repository).ReservationSummary,
+		expectedStatusCode: http.StatusNotFound,
+		expectedInBody:     `"ok": false`,
+	},
+	{
+		name:               "admin-reservations",
+		method:             "GET",
+		url:                "/admin/reservations-all?page=2",
+		handler:            (*Repository).AdminAllReservations,
+		expectedStatusCode: http.StatusOK,
+		expectedInBody:     `"page": 2`,
+	},
+	{
+		name:               "admin-search",
+		method:             "GET",
+		url:                "/admin/search?q=nobody",
+		handler:            (*Repository).AdminSearch,
+		expectedStatusCode: http.StatusOK,
+		expectedInBody:     `"upcoming": []`,
+	},
+	{
+		name:               "admin-users",
+		method:             "GET",
+		url:                "/admin/users",
+		handler:            (*Repository).AdminUsers,
+		expectedStatusCode: http.StatusOK,
+		expectedInBody:     `"two_factor": true`,
+	},
+	{
+		name:               "admin-reservations-invalid-filter",
+		method:             "GET",
+		url:                "/admin/reservations-all?status=lost",
+		handler:            (*Repository).AdminAllReservations,
+		expectedStatusCode: http.StatusBadRequest,
+		expectedInBody:     "unknown status",
+	},
+}
+
+// TestJSONResponses tests that handlers answer JSON to clients that accept it
+func TestJSONResponses(t *testing.T) {
+	for _, e := range jsonResponseTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.body != "" {
+			req, _ = http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+			req.Header.Set("Content-Type", "application/json")
+		}
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+
+		if e.reservation.RoomID > 0 {
+			session.Put(ctx, "reservation", e.reservation)
+		}
+
+		rr := httptest.NewRecorder()
+		e.handler(repo, rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s did not answer with json", e.name)
+		}
+		if !strings.Contains(rr.Body.String(), e.expectedInBody) {
+			t.Errorf("%s: expected to find %s in %s", e.name, e.expectedInBody, rr.Body.String())
+		}
+	}
+}
+
+// TestAdminSearch_Today tests that stays are grouped by today's UTC date, the dates they are stored with
+func TestAdminSearch_Today(t *testing.T) {
+	db, err := newTestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := initHandlers(&app, db)
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	expected := map[string]int{}
+	for group, stay := range map[string]models.Reservation{
+		"upcoming": {StartDate: today.AddDate(0, 0, 1), EndDate: today.AddDate(0, 0, 2)},
+		"current":  {StartDate: today, EndDate: today.AddDate(0, 0, 1)},
+		"past":     {StartDate: today.AddDate(0, 0, -1), EndDate: today},
+	} {
+		stay.FirstName, stay.LastName, stay.RoomID = "Search", "Today", 1
+		expected[group], err = db.InsertReservation(context.Background(), stay)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/search?q=Today", nil)
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(repo.AdminSearch)
+	handler.ServeHTTP(rr, req)
+
+	var groups map[string]json.RawMessage
+	err = json.Unmarshal(rr.Body.Bytes(), &groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for group, id := range expected {
+		var found []struct {
+			ID int `json:"id"`
+		}
+		err = json.Unmarshal(groups[group], &found)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].ID != id {
+			t.Errorf("expected reservation %d alone in %s, got %s", id, group, groups[group])
+		}
+	}
+}
+
 // chooseRoomTests is the data for ChooseRoom handler tests, /choose-room/{id}
 var chooseRoomTests = []struct {
 	name               string
@@ -530,7 +792,7 @@ func TestChooseRoom(t *testing.T) {
 			session.Put(ctx, "reservation", e.reservation)
 		}
 
-		handler := http.HandlerFunc(Repo.ChooseRoom)
+		handler := http.HandlerFunc(repo.ChooseRoom)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedStatusCode {
@@ -565,7 +827,7 @@ func TestRepository_BookRoom(t *testing.T) {
 	rr := httptest.NewRecorder()
 	session.Put(ctx, "reservation", reservation)
 
-	handler := http.HandlerFunc(Repo.BookRoom)
+	handler := http.HandlerFunc(repo.BookRoom)
 
 	handler.ServeHTTP(rr, req)
 
@@ -574,7 +836,7 @@ func TestRepository_BookRoom(t *testing.T) {
 	}
 
 	/*****************************************
-	// second case -- database failed
+	// second case -- room does not exist
 	*****************************************/
 	req, _ = http.NewRequest("GET", "/book-room?s=2040-01-01&e=2040-01-02&id=4", nil)
 	ctx = getCtx(req)
@@ -582,7 +844,7 @@ func TestRepository_BookRoom(t *testing.T) {
 
 	rr = httptest.NewRecorder()
 
-	handler = http.HandlerFunc(Repo.BookRoom)
+	handler = http.HandlerFunc(repo.BookRoom)
 
 	handler.ServeHTTP(rr, req)
 
@@ -591,6 +853,699 @@ func TestRepository_BookRoom(t *testing.T) {
 	}
 }
 
+// reservationFilterTests is the data for parsing export and list filters from the query string
+var reservationFilterTests = []struct {
+	name           string
+	query          string
+	expectedRoomID int
+	expectedStatus string
+	expectedError  bool
+}{
+	{"empty", "", 0, "", false},
+	{"full", "?start=2050-01-01&end=2050-02-01&room_id=2&status=new", 2, "new", false},
+	{"bad-date", "?start=01/01/2050", 0, "", true},
+	{"bad-room", "?room_id=fish", 0, "", true},
+	{"bad-status", "?status=archived", 0, "", true},
+}
+
+func TestReservationFilterFromQuery(t *testing.T) {
+	for _, e := range reservationFilterTests {
+		req, _ := http.NewRequest("GET", "/admin/reservations-export"+e.query, nil)
+
+		filter, err := reservationFilterFromQuery(req)
+		if (err != nil) != e.expectedError {
+			t.Errorf("%s: expected error %v, got %v", e.name, e.expectedError, err)
+			continue
+		}
+
+		if filter.RoomID != e.expectedRoomID || filter.Status != e.expectedStatus {
+			t.Errorf("%s: got room %d and status '%s'", e.name, filter.RoomID, filter.Status)
+		}
+	}
+}
+
+// TestAdminExportReservations tests that guest input cannot become a formula in the exported CSV
+func TestAdminExportReservations(t *testing.T) {
+	db, err := newTestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := initHandlers(&app, db)
+
+	arrival := time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)
+	_, err = db.InsertReservation(context.Background(), models.Reservation{
+		FirstName: "=HYPERLINK(\"http://evil.example\")",
+		LastName:  "@SUM(A1:A2)",
+		Email:     "-2+3@here.com",
+		Phone:     "+1 555 555 5555",
+		RoomID:    1,
+		StartDate: arrival,
+		EndDate:   arrival.AddDate(0, 0, 2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/reservations-export?start=2050-03-01", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(repo.AdminExportReservations)
+	handler.ServeHTTP(rr, req)
+
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(rr.Body.String(), "\uFEFF"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected a header and one reservation, got %d rows", len(rows))
+	}
+
+	expected := []string{`'=HYPERLINK("http://evil.example")`, "'@SUM(A1:A2)", "'-2+3@here.com", "'+1 555 555 5555", "General's Quarters"}
+	if !reflect.DeepEqual(rows[1][2:7], expected) {
+		t.Errorf("expected guest fields %q, got %q", expected, rows[1][2:7])
+	}
+}
+
+// TestAdminDashboard tests today's numbers and that a night blocked twice counts once in the occupancy
+func TestAdminDashboard(t *testing.T) {
+	db, err := newTestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := initHandlers(&app, db)
+	ctx := context.Background()
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	stays := []models.Reservation{
+		{FirstName: "Arriving", LastName: "Guest", RoomID: 1, StartDate: today, EndDate: today.AddDate(0, 0, 3)},
+		{FirstName: "Departing", LastName: "Guest", RoomID: 2, StartDate: today.AddDate(0, 0, -2), EndDate: today},
+	}
+	for _, stay := range stays {
+		id, err := db.InsertReservation(ctx, stay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.InsertRoomRestriction(ctx, models.RoomRestriction{
+			RoomID: stay.RoomID, ReservationID: id, RestrictionID: models.RestrictionReservation,
+			StartDate: stay.StartDate, EndDate: stay.EndDate,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an external booking of a night room 1 is already reserved for
+	err = db.InsertRoomRestriction(ctx, models.RoomRestriction{
+		RoomID: 1, RestrictionID: models.RestrictionExternal, StartDate: today, EndDate: today.AddDate(0, 0, 1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/dashboard", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(repo.AdminDashboard)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("AdminDashboard handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	for _, expected := range []string{
+		"1 / 2 (50%)",
+		"Arriving Guest",
+		"Departing Guest",
+		"General&#39;s Quarters &mdash; 3 of 30 nights",
+		"Major&#39;s Suite &mdash; 2 of 30 nights",
+	} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected '%s' on the dashboard", expected)
+		}
+	}
+
+	// a failing repository is a server error
+	req, _ = http.NewRequest("GET", "/admin/dashboard", nil)
+	req = req.WithContext(getCtx(req))
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(newBrokenRepo().AdminDashboard)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminDashboard handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+// forgotPasswordTests is the data for the PostForgotPassword handler test, /user/forgot-password
+var forgotPasswordTests = []struct {
+	name               string
+	email              string
+	expectedStatusCode int
+	expectedMail       bool
+}{
+	{"known-email", "admin@here.com", http.StatusSeeOther, true},
+	{"unknown-email", "missing@here.com", http.StatusSeeOther, false},
+	{"invalid-email", "not-an-email", http.StatusOK, false},
+}
+
+func TestPostForgotPassword(t *testing.T) {
+	for _, e := range forgotPasswordTests {
+		postedData := url.Values{"email": {e.email}}
+		req, _ := http.NewRequest("POST", "/user/forgot-password", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(repo.PostForgotPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		select {
+		case msg := <-app.MailChan:
+			if !e.expectedMail {
+				t.Errorf("%s: unexpected mail sent to %s", e.name, msg.To)
+			} else if !strings.Contains(msg.Content, app.BaseURL+"/user/reset-password?token=") {
+				t.Errorf("%s: mail does not contain a reset link", e.name)
+			}
+		default:
+			if e.expectedMail {
+				t.Errorf("%s: expected a reset mail, but none was sent", e.name)
+			}
+		}
+	}
+}
+
+// TestPostForgotPassword_MailQueueFull tests that a full mail queue does not hold up the request
+func TestPostForgotPassword_MailQueueFull(t *testing.T) {
+	full := app
+	full.MailChan = make(chan models.MailData)
+	handlers := initHandlers(&full, repo.DB)
+
+	postedData := url.Values{"email": {"admin@here.com"}}
+	req, _ := http.NewRequest("POST", "/user/forgot-password", strings.NewReader(postedData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handlers.PostForgotPassword(rr, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request blocked on the full mail queue")
+	}
+}
+
+// resetPasswordTests is the data for the PostResetPassword handler test, /user/reset-password
+var resetPasswordTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		name: "valid",
+		postedData: url.Values{
+			"token":            {testResetToken},
+			"password":         {"correct horse 9"},
+			"password_confirm": {"correct horse 9"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/user/login",
+	},
+	{
+		name: "weak-password",
+		postedData: url.Values{
+			"token":            {testResetToken},
+			"password":         {"short"},
+			"password_confirm": {"short"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "mismatch",
+		postedData: url.Values{
+			"token":            {testResetToken},
+			"password":         {"correct horse 9"},
+			"password_confirm": {"correct horse 8"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "invalid-token",
+		postedData: url.Values{
+			"token":            {"invalid"},
+			"password":         {"correct horse 9"},
+			"password_confirm": {"correct horse 9"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/user/forgot-password",
+	},
+}
+
+func TestPostResetPassword(t *testing.T) {
+	// the valid case uses up the reset token the other tests need
+	db, err := newTestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := initHandlers(&app, db)
+
+	for _, e := range resetPasswordTests {
+		req, _ := http.NewRequest("POST", "/user/reset-password", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(repo.PostResetPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestShowResetPassword(t *testing.T) {
+	for token, expectedStatusCode := range map[string]int{testResetToken: http.StatusOK, "invalid": http.StatusSeeOther} {
+		req, _ := http.NewRequest("GET", "/user/reset-password?token="+token, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(repo.ShowResetPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != expectedStatusCode {
+			t.Errorf("token %s returned wrong response code: got %d, wanted %d", token, rr.Code, expectedStatusCode)
+		}
+	}
+}
+
+// loginTests is the data for the Login handler test, /user/login
+var loginTests = []struct {
+	name               string
+	email              string
+	password           string
+	remoteAddr         string
+	expectedStatusCode int
+	expectedLoggedIn   bool
+	expectedError      string
+	expectedLocation   string
+}{
+	{
+		name:               "valid-credentials",
+		email:              "me@here.ca",
+		password:           testPassword,
+		remoteAddr:         "192.0.2.1:1234",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLoggedIn:   true,
+		expectedLocation:   "/",
+	},
+	{
+		name:               "two-factor-required",
+		email:              "twofactor@here.com",
+		password:           testPassword,
+		remoteAddr:         "192.0.2.1:1234",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/user/login/two-factor",
+	},
+	{
+		name:               "invalid-email",
+		email:              "me",
+		password:           testPassword,
+		remoteAddr:         "192.0.2.1:1234",
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "wrong-password",
+		email:              "me@here.ca",
+		password:           "wrong",
+		remoteAddr:         "192.0.2.1:1234",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedError:      "invalid login credentials",
+	},
+	{
+		name:               "locked-account",
+		email:              "locked@here.com",
+		password:           testPassword,
+		remoteAddr:         "192.0.2.1:1234",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedError:      "too many failed login attempts",
+	},
+	{
+		name:               "account-backoff",
+		email:              "throttled@here.com",
+		password:           testPassword,
+		remoteAddr:         "192.0.2.1:1234",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedError:      "too many failed login attempts",
+	},
+	{
+		name:               "ip-backoff",
+		email:              "me@here.ca",
+		password:           testPassword,
+		remoteAddr:         testThrottledIP + ":1234",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedError:      "too many failed login attempts",
+	},
+}
+
+func TestLogin(t *testing.T) {
+	for _, e := range loginTests {
+		postedData := url.Values{"email": {e.email}, "password": {e.password}}
+		req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = e.remoteAddr
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(repo.Login)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if loggedIn := session.Exists(ctx, "user_id"); loggedIn != e.expectedLoggedIn {
+			t.Errorf("%s: expected logged in to be %t, got %t", e.name, e.expectedLoggedIn, loggedIn)
+		}
+
+		if msg := session.GetString(ctx, "error"); !strings.HasPrefix(msg, e.expectedError) || (e.expectedError == "" && msg != "") {
+			t.Errorf("%s: expected error '%s', got '%s'", e.name, e.expectedError, msg)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+func TestPostTwoFactorLogin(t *testing.T) {
+	currentCode, _ := auth.TOTPCode(testTOTPSecret, auth.TOTPStep(time.Now()))
+	wrongCode, _ := auth.TOTPCode(testTOTPSecret, auth.TOTPStep(time.Now())+10)
+
+	tests := []struct {
+		name             string
+		code             string
+		pending          bool
+		startedAt        time.Time
+		expectedLoggedIn bool
+		expectedLocation string
+	}{
+		{"totp-code", currentCode, true, time.Now(), true, "/"},
+		{"recovery-code", "ABCDE FGHJK", true, time.Now(), true, "/"},
+		{"wrong-code", wrongCode, true, time.Now(), false, "/user/login/two-factor"},
+		{"no-password-step", currentCode, false, time.Now(), false, "/user/login"},
+		{"expired-password-step", currentCode, true, time.Now().Add(-time.Hour), false, "/user/login"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{"code": {e.code}}
+		req, _ := http.NewRequest("POST", "/user/login/two-factor", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.pending {
+			session.Put(ctx, "two_factor_user_id", twoFactorUserID)
+			session.Put(ctx, "two_factor_started_at", e.startedAt)
+		}
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(repo.PostTwoFactorLogin)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		if loggedIn := session.Exists(ctx, "user_id"); loggedIn != e.expectedLoggedIn {
+			t.Errorf("%s: expected logged in to be %t, got %t", e.name, e.expectedLoggedIn, loggedIn)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+// inviteUserTests is the data for the AdminPostInviteUser handler test, /admin/users/invite
+var inviteUserTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedMail       bool
+}{
+	{
+		name: "valid",
+		postedData: url.Values{
+			"first_name":   {"John"},
+			"last_name":    {"Smith"},
+			"email":        {"missing@here.com"},
+			"access_level": {"2"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedMail:       true,
+	},
+	{
+		name: "email-taken",
+		postedData: url.Values{
+			"first_name":   {"John"},
+			"last_name":    {"Smith"},
+			"email":        {"me@here.ca"},
+			"access_level": {"2"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "unknown-access-level",
+		postedData: url.Values{
+			"first_name":   {"John"},
+			"last_name":    {"Smith"},
+			"email":        {"missing@here.com"},
+			"access_level": {"9"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "missing-name",
+		postedData: url.Values{
+			"email":        {"missing@here.com"},
+			"access_level": {"1"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+}
+
+func TestAdminPostInviteUser(t *testing.T) {
+	for _, e := range inviteUserTests {
+		req, _ := http.NewRequest("POST", "/admin/users/invite", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(repo.AdminPostInviteUser)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		select {
+		case msg := <-app.MailChan:
+			if !e.expectedMail {
+				t.Errorf("%s: unexpected mail sent to %s", e.name, msg.To)
+			} else if !strings.Contains(msg.Content, app.BaseURL+"/user/reset-password?token=") {
+				t.Errorf("%s: mail does not contain an invitation link", e.name)
+			}
+		default:
+			if e.expectedMail {
+				t.Errorf("%s: expected an invitation mail, but none was sent", e.name)
+			}
+		}
+	}
+}
+
+// changePasswordTests is the data for the PostChangePassword handler test, /user/password
+var changePasswordTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+}{
+	{
+		name: "valid",
+		postedData: url.Values{
+			"current_password": {"password"},
+			"password":         {"correct horse 9"},
+			"password_confirm": {"correct horse 9"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+	},
+	{
+		name: "wrong-current-password",
+		postedData: url.Values{
+			"current_password": {"wrong"},
+			"password":         {"correct horse 9"},
+			"password_confirm": {"correct horse 9"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "weak-password",
+		postedData: url.Values{
+			"current_password": {"password"},
+			"password":         {"short"},
+			"password_confirm": {"short"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "mismatch",
+		postedData: url.Values{
+			"current_password": {"password"},
+			"password":         {"correct horse 9"},
+			"password_confirm": {"correct horse 8"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+}
+
+func TestPostChangePassword(t *testing.T) {
+	for _, e := range changePasswordTests {
+		req, _ := http.NewRequest("POST", "/user/password", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		ctx = helpers.WithUser(ctx, models.User{ID: 1, Email: "me@here.ca", Active: true})
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(repo.PostChangePassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestPostChangePassword_NotLoggedIn(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/user/password", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(repo.PostChangePassword)
+	handler.ServeHTTP(rr, req)
+
+	actualLoc, _ := rr.Result().Location()
+	if rr.Code != http.StatusSeeOther || actualLoc.String() != "/user/login" {
+		t.Errorf("expected redirect to /user/login, got %d %s", rr.Code, actualLoc)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	routes := getRoutes()
+	ts := httptest.NewTLSServer(routes)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/no-such-page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+}
+
+// localeTests is the data for the PostLocale handler test, /locale
+var localeTests = []struct {
+	name             string
+	locale           string
+	referer          string
+	expectedLocale   string
+	expectedLocation string
+}{
+	{"switch-to-russian", "ru", "http://localhost/search-availability?x=1", "ru", "/search-availability?x=1"},
+	{"unknown-language", "xx", "", "", "/"},
+	{"foreign-referer", "en", "https://elsewhere.example/phish", "en", "/"},
+	{"relative-referer", "en", "/about", "en", "/about"},
+	{"scheme-relative-path", "en", "http://localhost//evil.example/x", "en", "/"},
+	{"backslash-path", "en", "http://localhost/\\evil.example/x", "en", "/"},
+	{"scheme-relative-referer", "en", "//evil.example/x", "en", "/"},
+	{"opaque-referer", "en", "javascript:alert(1)", "en", "/"},
+}
+
+func TestPostLocale(t *testing.T) {
+	for _, e := range localeTests {
+		postedData := url.Values{"locale": {e.locale}}
+		req, _ := http.NewRequest("POST", "/locale", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Referer", e.referer)
+		req.Host = "localhost"
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(repo.PostLocale)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+		if location := rr.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLocation, location)
+		}
+		if locale := session.GetString(ctx, "locale"); locale != e.expectedLocale {
+			t.Errorf("%s: expected locale '%s' in session, got '%s'", e.name, e.expectedLocale, locale)
+		}
+	}
+}
+
+// TestLocalizedPage tests that pages, form errors and flash messages are shown in the request's language
+func TestLocalizedPage(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(url.Values{"email": {"not-an-email"}}.Encode()))
+	ctx := i18n.WithLocale(getCtx(req), "ru")
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(repo.Login)
+	handler.ServeHTTP(rr, req)
+
+	for _, expected := range []string{`lang="ru"`, "Забронировать", "Неверный адрес электронной почты", "Это поле нужно заполнить"} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected to find %s in the russian login page", expected)
+		}
+	}
+}
+
 func getCtx(req *http.Request) context.Context {
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
 	if err != nil {
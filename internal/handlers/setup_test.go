@@ -1,17 +1,27 @@
 package handlers
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"github.com/Sunpacker/go-booking-app/internal/auth"
 	"github.com/Sunpacker/go-booking-app/internal/config"
-	"github.com/Sunpacker/go-booking-app/internal/driver"
+	"github.com/Sunpacker/go-booking-app/internal/helpers"
+	"github.com/Sunpacker/go-booking-app/internal/i18n"
+	"github.com/Sunpacker/go-booking-app/internal/logging"
+	"github.com/Sunpacker/go-booking-app/internal/metrics"
 	"github.com/Sunpacker/go-booking-app/internal/models"
 	"github.com/Sunpacker/go-booking-app/internal/render"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"github.com/Sunpacker/go-booking-app/internal/repository/dbrepo"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"golang.org/x/crypto/bcrypt"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -22,9 +32,8 @@ import (
 
 var app config.AppConfig
 var session *scs.SessionManager
-var functions = template.FuncMap{
-	"formatDate": render.FormatDate,
-}
+var repo *Repository
+var functions = render.Functions(i18n.DefaultLocale)
 
 func TestMain(m *testing.M) {
 	gob.Register(models.User{})
@@ -35,16 +44,16 @@ func TestMain(m *testing.M) {
 
 	app.IsProd = false
 	app.UseCache = true
-	app.InfoLog = log.New(os.Stdout, "[INFO]\t", log.Ldate|log.Ltime)
-	app.ErrorLog = log.New(os.Stdout, "[ERROR]\t", log.Ldate|log.Ltime|log.Lshortfile)
+	app.Logger = logging.New(os.Stdout, false, slog.LevelInfo)
+	app.BaseURL = "http://localhost:8080"
+	app.MailChan = make(chan models.MailData, 100)
 
-	db, err := driver.ConnectSQL("host=localhost port=5432 dbname=booking-app user=postgres password=root")
+	initSession()
+	db, err := newTestDB()
 	if err != nil {
-		log.Fatal("cannot connect to database, dying...")
+		log.Fatal("cannot seed test database: ", err)
 	}
-
-	initSession()
-	initHandlers(db)
+	repo = initHandlers(&app, db)
 	err = initPages()
 	if err != nil {
 		log.Fatal("cannot create template cache")
@@ -56,6 +65,9 @@ func TestMain(m *testing.M) {
 func getRoutes() http.Handler {
 	mux := chi.NewRouter()
 
+	mux.NotFound(repo.NotFound)
+	mux.MethodNotAllowed(repo.MethodNotAllowed)
+
 	initMiddlewares(mux)
 	initStaticFilesDir(mux)
 	initPageRoutes(mux)
@@ -72,10 +84,118 @@ func initSession() {
 	app.Session = session
 }
 
-func initHandlers(db *driver.DB) {
-	_ = db
-	repo := NewTestRepo(&app)
-	NewHandlers(repo)
+// initHandlers builds the handlers from a repository and an app config only, so the tests need no database server
+func initHandlers(a *config.AppConfig, db repository.DatabaseRepo) *Repository {
+	return NewRepo(a, db, render.NewRenderer(a), metrics.New())
+}
+
+// the seeded users all log in with testPassword; twoFactorUserID also needs a code from testTOTPSecret
+// or testRecoveryCode, and testThrottledIP has too many recent failed logins to try again
+const (
+	testPassword     = "password"
+	twoFactorUserID  = 2
+	testTOTPSecret   = "JBSWY3DPEHPK3PXP"
+	testRecoveryCode = "abcde-fghjk"
+	testResetToken   = "valid"
+	testThrottledIP  = "10.0.0.66"
+	testBookedFrom   = "2050-01-01"
+	testBookedUntil  = "2050-01-02"
+)
+
+// newTestDB returns a memory repository with both rooms booked from testBookedFrom to testBookedUntil,
+// a reset token for the first user and a user for every login case the tests cover
+func newTestDB() (repository.DatabaseRepo, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		return nil, err
+	}
+	password := string(hashedPassword)
+	now := time.Now()
+
+	db := dbrepo.NewMemoryRepo(&app, dbrepo.MemoryData{
+		Rooms: []models.Room{
+			{RoomName: "General's Quarters", NightlyRate: 9900},
+			{RoomName: "Major's Suite", NightlyRate: 14900},
+		},
+		Users: []models.User{
+			{FirstName: "Me", Email: "me@here.ca", Password: password, AccessLevel: 3, Active: true},
+			{FirstName: "Two", Email: "twofactor@here.com", Password: password, AccessLevel: 1, Active: true},
+			{FirstName: "Admin", Email: "admin@here.com", Password: password, AccessLevel: 3, Active: true},
+			{FirstName: "Locked", Email: "locked@here.com", Password: password, AccessLevel: 1, Active: true,
+				FailedLogins: 10, LastFailedLoginAt: now, LockedUntil: now.Add(time.Hour)},
+			{FirstName: "Throttled", Email: "throttled@here.com", Password: password, AccessLevel: 1, Active: true,
+				FailedLogins: 8, LastFailedLoginAt: now},
+		},
+	})
+
+	ctx := context.Background()
+	start, _ := time.Parse("2006-01-02", testBookedFrom)
+	end, _ := time.Parse("2006-01-02", testBookedUntil)
+	for _, roomID := range []int{1, 2} {
+		id, err := db.InsertReservation(ctx, models.Reservation{FirstName: "John", LastName: "Smith", RoomID: roomID, StartDate: start, EndDate: end})
+		if err != nil {
+			return nil, err
+		}
+		err = db.InsertRoomRestriction(ctx, models.RoomRestriction{
+			RoomID: roomID, ReservationID: id, RestrictionID: models.RestrictionReservation, StartDate: start, EndDate: end,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.SetTOTPSecret(ctx, twoFactorUserID, testTOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	err = db.EnableTOTP(ctx, twoFactorUserID, 0, []string{helpers.HashToken(auth.NormalizeRecoveryCode(testRecoveryCode))})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.InsertPasswordResetToken(ctx, 1, helpers.HashToken(testResetToken), now.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	// well past auth.IPThrottle's free attempts
+	for i := 0; i < 20; i++ {
+		err = db.InsertLoginEvent(ctx, models.LoginEvent{Email: "me@here.ca", IPAddress: testThrottledIP})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// errBrokenDB is what brokenDB answers with
+var errBrokenDB = errors.New("database is down")
+
+// brokenDB is a repository whose searches, bookings and dashboard stats fail, for testing how handlers report database errors
+type brokenDB struct {
+	repository.DatabaseRepo
+}
+
+func (b brokenDB) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	return nil, errBrokenDB
+}
+
+func (b brokenDB) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	return false, errBrokenDB
+}
+
+func (b brokenDB) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	return errBrokenDB
+}
+
+func (b brokenDB) DashboardStats(ctx context.Context, day time.Time) (models.DashboardStats, error) {
+	return models.DashboardStats{}, errBrokenDB
+}
+
+// newBrokenRepo returns handlers on top of a brokenDB
+func newBrokenRepo() *Repository {
+	return initHandlers(&app, brokenDB{repo.DB})
 }
 
 func initPages() error {
@@ -85,7 +205,6 @@ func initPages() error {
 	}
 
 	app.TemplateCache = templateCache
-	render.NewRenderer(&app)
 
 	return nil
 }
@@ -143,17 +262,16 @@ func initStaticFilesDir(mux *chi.Mux) {
 }
 
 func initPageRoutes(mux *chi.Mux) {
-	mux.Get("/", Repo.Home)
-	mux.Get("/about", Repo.About)
-	mux.Get("/generals-quarters", Repo.Generals)
-	mux.Get("/majors-suite", Repo.Majors)
+	mux.Get("/", repo.Home)
+	mux.Get("/about", repo.About)
+	mux.Get("/generals-quarters", repo.Generals)
+	mux.Get("/majors-suite", repo.Majors)
 
-	mux.Get("/search-availability", Repo.Availability)
-	mux.Post("/search-availability", Repo.PostAvailability)
-	mux.Get("/search-availability-json", Repo.AvailabilityJSON)
+	mux.Get("/search-availability", repo.Availability)
+	mux.Post("/search-availability", repo.PostAvailability)
 
-	mux.Get("/make-reservation", Repo.Reservation)
-	mux.Post("/make-reservation", Repo.PostReservation)
+	mux.Get("/make-reservation", repo.Reservation)
+	mux.Post("/make-reservation", repo.PostReservation)
 
-	mux.Get("/contact", Repo.Contact)
+	mux.Get("/contact", repo.Contact)
 }
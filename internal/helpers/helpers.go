@@ -1,29 +1,104 @@
 package helpers
 
 import (
-	"fmt"
-	"github.com/Sunpacker/go-booking-app/internal/config"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"log/slog"
+	"net"
 	"net/http"
 	"runtime/debug"
 )
 
-var app *config.AppConfig
-
-func NewHelpers(a *config.AppConfig) {
-	app = a
-}
-
-//func ClientError(w http.ResponseWriter, status int) {
-//	app.InfoLog.Println("client error with status of", status)
+//func ClientError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, status int) {
+//	logger.InfoContext(r.Context(), "client error", slog.Int("status", status))
 //	http.Error(w, http.StatusText(status), status)
 //}
 
-func ServerError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+// ServerError logs err to logger with the stack trace and the request it failed, then answers with a 500
+func ServerError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error) {
+	logger.ErrorContext(r.Context(), "server error",
+		slog.String("error", err.Error()),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("stack", string(debug.Stack())),
+	)
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
 func IsAuthenticated(r *http.Request) bool {
-	return app.Session.Exists(r.Context(), "user_id")
+	_, ok := CurrentUser(r)
+	return ok
+}
+
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+// WithUser returns a copy of ctx carrying the logged-in user
+func WithUser(ctx context.Context, user models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// CurrentUser returns the logged-in user, loaded once per request by the LoadUser middleware
+func CurrentUser(r *http.Request) (models.User, bool) {
+	user, ok := r.Context().Value(userContextKey).(models.User)
+	return user, ok
+}
+
+// ClientIP returns the address of the peer that sent r. Forwarding headers are ignored
+// because clients can set them freely, which would let them dodge login throttling.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// confirmationAlphabet leaves out characters that are easy to confuse when read aloud (0/O, 1/I/L)
+const confirmationAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// NewConfirmationCode returns a random 8-character code guests can quote to find their booking
+func NewConfirmationCode() (string, error) {
+	// bytes at or above the largest multiple of the alphabet size are skipped, so every character is equally likely
+	limit := 256 - 256%len(confirmationAlphabet)
+
+	code := make([]byte, 0, 8)
+	random := make([]byte, 16)
+	for len(code) < cap(code) {
+		_, err := rand.Read(random)
+		if err != nil {
+			return "", err
+		}
+
+		for _, b := range random {
+			if int(b) < limit && len(code) < cap(code) {
+				code = append(code, confirmationAlphabet[int(b)%len(confirmationAlphabet)])
+			}
+		}
+	}
+
+	return string(code), nil
+}
+
+// NewToken returns a random URL-safe token to hand out and the hash to store in its place
+func NewToken() (string, string, error) {
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(random)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded sha256 digest under which a token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
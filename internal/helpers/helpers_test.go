@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/Sunpacker/go-booking-app/internal/logging"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewConfirmationCode(t *testing.T) {
+	seen := make(map[string]bool)
+
+	for i := 0; i < 100; i++ {
+		code, err := NewConfirmationCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(code) != 8 {
+			t.Errorf("expected 8 characters, got '%s'", code)
+		}
+		for _, c := range code {
+			if !strings.ContainsRune(confirmationAlphabet, c) {
+				t.Errorf("code '%s' contains '%c' outside of the alphabet", code, c)
+			}
+		}
+
+		if seen[code] {
+			t.Errorf("code '%s' generated twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token == "" || strings.ContainsAny(token, "+/=") {
+		t.Errorf("token '%s' is not url-safe", token)
+	}
+	if hash != HashToken(token) {
+		t.Error("returned hash does not match the token")
+	}
+	if HashToken("invalid") != "f1234d75178d892a133a410355a5a990cf75d2f33eba25d575943d4df632f3a4" {
+		t.Error("token is not hashed with sha256")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:52100"
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Errorf("expected 203.0.113.7, got %s", ip)
+	}
+
+	r.RemoteAddr = "[2001:db8::1]:443"
+	if ip := ClientIP(r); ip != "2001:db8::1" {
+		t.Errorf("expected 2001:db8::1, got %s", ip)
+	}
+}
+
+func TestCurrentUser(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, ok := CurrentUser(r); ok || IsAuthenticated(r) {
+		t.Error("request without user reported as authenticated")
+	}
+
+	r = r.WithContext(WithUser(r.Context(), models.User{ID: 7, FirstName: "Ann"}))
+	user, ok := CurrentUser(r)
+	if !ok || user.ID != 7 || !IsAuthenticated(r) {
+		t.Errorf("user not found in context: %+v", user)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.New(&out, true, slog.LevelInfo)
+
+	r := httptest.NewRequest("POST", "/make-reservation", nil)
+	ctx := logging.NewContext(r.Context())
+	logging.AddAttrs(ctx, slog.String("request_id", "abc"))
+	r = r.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	ServerError(rr, r, logger, errors.New("insert failed"))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rr.Code)
+	}
+
+	var record map[string]interface{}
+	err := json.Unmarshal(out.Bytes(), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record["level"] != "ERROR" || record["error"] != "insert failed" || record["request_id"] != "abc" ||
+		record["path"] != "/make-reservation" || record["stack"] == "" {
+		t.Errorf("wrong log record: %v", record)
+	}
+}
@@ -0,0 +1,166 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the language the source strings are written in
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalogs maps a locale to its translations, keyed by the English source text.
+// The default locale needs no catalog: a missing translation falls back to the key itself.
+var catalogs = mustLoadCatalogs(localeFiles)
+
+// names are what each locale calls its own language
+var names = map[string]string{
+	"en": "English",
+	"ru": "Русский",
+}
+
+// dateLayouts are the layouts FormatDate uses for each locale
+var dateLayouts = map[string]string{
+	"en": "Jan 2, 2006",
+	"ru": "02.01.2006",
+}
+
+func mustLoadCatalogs(fsys fs.FS) map[string]map[string]string {
+	loaded, err := loadCatalogs(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+// loadCatalogs reads one JSON object of source text to translation per locale, named <locale>.json
+func loadCatalogs(fsys fs.FS) (map[string]map[string]string, error) {
+	loaded := map[string]map[string]string{
+		DefaultLocale: {},
+	}
+
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		messages := make(map[string]string)
+		err = json.Unmarshal(content, &messages)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read catalog %s: %w", file, err)
+		}
+
+		locale := strings.TrimSuffix(path.Base(file), ".json")
+		loaded[locale] = messages
+	}
+
+	return loaded, nil
+}
+
+// Locales returns the supported locales in alphabetical order
+func Locales() []string {
+	var locales []string
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supported reports whether there is a catalog for locale
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Name returns the name of locale's language in that language
+func Name(locale string) string {
+	if name, ok := names[locale]; ok {
+		return name
+	}
+	return locale
+}
+
+// T translates key into locale and fills in its placeholders like fmt.Sprintf.
+// Keys without a translation are used as they are.
+func T(locale, key string, args ...interface{}) string {
+	message, ok := catalogs[locale][key]
+	if !ok || message == "" {
+		message = key
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// FormatDate writes t the way it is usually written in locale
+func FormatDate(locale string, t time.Time) string {
+	layout, ok := dateLayouts[locale]
+	if !ok {
+		layout = dateLayouts[DefaultLocale]
+	}
+	return t.Format(layout)
+}
+
+// Match picks the supported locale the Accept-Language header prefers,
+// or the default locale if it names none of them
+func Match(acceptLanguage string) string {
+	best, bestQuality := DefaultLocale, 0.0
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		// only the language matters, so en-GB and en-US both pick en
+		language, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if Supported(language) && quality > bestQuality {
+			best, bestQuality = language, quality
+		}
+	}
+
+	return best
+}
+
+type contextKey string
+
+const localeContextKey = contextKey("locale")
+
+// WithLocale returns a copy of ctx carrying the locale of the request
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeContextKey, locale)
+}
+
+// FromContext returns the locale chosen for the request, or the default locale if none was
+func FromContext(ctx context.Context) string {
+	locale, ok := ctx.Value(localeContextKey).(string)
+	if !ok || locale == "" {
+		return DefaultLocale
+	}
+	return locale
+}
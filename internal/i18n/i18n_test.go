@@ -0,0 +1,88 @@
+package i18n
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestT(t *testing.T) {
+	if T("ru", "Book Now") != "Забронировать" {
+		t.Error("message not translated")
+	}
+	if T("ru", "This field must be at least %d characters long", 3) != "Значение должно быть не короче 3 символов" {
+		t.Error("arguments not filled into the translation")
+	}
+	if T("ru", "not in the catalog") != "not in the catalog" {
+		t.Error("missing translation does not fall back to the key")
+	}
+	if T("en", "Password must be at least %d characters long", 10) != "Password must be at least 10 characters long" {
+		t.Error("default locale does not use the key as the message")
+	}
+	if T("xx", "Book Now") != "Book Now" {
+		t.Error("unknown locale does not fall back to the key")
+	}
+}
+
+// verbs finds fmt verbs, which a translation has to keep in the same order
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+
+func TestCatalogs(t *testing.T) {
+	for locale, messages := range catalogs {
+		for key, message := range messages {
+			if message == "" {
+				t.Errorf("%s: empty translation for '%s'", locale, key)
+			}
+			if verbs.FindAllString(key, -1) == nil && verbs.FindAllString(message, -1) == nil {
+				continue
+			}
+			if len(verbs.FindAllString(key, -1)) != len(verbs.FindAllString(message, -1)) {
+				t.Errorf("%s: '%s' does not keep the placeholders of '%s'", locale, message, key)
+			}
+		}
+	}
+}
+
+var matchTests = []struct {
+	acceptLanguage string
+	expected       string
+}{
+	{"", "en"},
+	{"ru", "ru"},
+	{"ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7", "ru"},
+	{"de-DE,en;q=0.5,ru;q=0.8", "ru"},
+	{"de-DE", "en"},
+	{"ru;q=bad,en;q=0.1", "en"},
+}
+
+func TestMatch(t *testing.T) {
+	for _, e := range matchTests {
+		if locale := Match(e.acceptLanguage); locale != e.expected {
+			t.Errorf("'%s' matched %s, wanted %s", e.acceptLanguage, locale, e.expected)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2050, 1, 9, 0, 0, 0, 0, time.UTC)
+
+	if FormatDate("en", date) != "Jan 9, 2050" {
+		t.Errorf("wrong english date: %s", FormatDate("en", date))
+	}
+	if FormatDate("ru", date) != "09.01.2050" {
+		t.Errorf("wrong russian date: %s", FormatDate("ru", date))
+	}
+	if FormatDate("xx", date) != FormatDate(DefaultLocale, date) {
+		t.Error("unknown locale does not use the default layout")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != DefaultLocale {
+		t.Error("request without a locale does not use the default one")
+	}
+	if FromContext(WithLocale(context.Background(), "ru")) != "ru" {
+		t.Error("locale not read back from the context")
+	}
+}
@@ -0,0 +1,168 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is a single VEVENT block from an iCalendar feed
+type Event struct {
+	UID       string
+	Summary   string
+	StartDate time.Time
+	EndDate   time.Time
+	Cancelled bool
+}
+
+const dateLayout = "20060102"
+const dateTimeLayout = "20060102T150405"
+
+// Parse reads an iCalendar (RFC 5545) document and returns its events.
+// Only the properties needed to block room dates are read; everything else is ignored.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	sawCalendar := false
+
+	for _, line := range lines {
+		name, params, value := splitProperty(line)
+
+		switch {
+		case name == "BEGIN" && value == "VCALENDAR":
+			sawCalendar = true
+		case name == "BEGIN" && value == "VEVENT":
+			current = &Event{}
+		case name == "END" && value == "VEVENT":
+			if current == nil {
+				return nil, errors.New("END:VEVENT without BEGIN:VEVENT")
+			}
+
+			if current.EndDate.IsZero() {
+				// a date-only event without DTEND lasts one day
+				current.EndDate = current.StartDate.AddDate(0, 0, 1)
+			}
+
+			if current.UID == "" {
+				return nil, errors.New("event without UID")
+			}
+			if current.StartDate.IsZero() {
+				return nil, fmt.Errorf("event '%s' has no DTSTART", current.UID)
+			}
+
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			continue
+		case name == "UID":
+			current.UID = value
+		case name == "SUMMARY":
+			current.Summary = unescape(value)
+		case name == "STATUS":
+			current.Cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART":
+			current.StartDate, err = parseDate(params, value)
+			if err != nil {
+				return nil, err
+			}
+		case name == "DTEND":
+			current.EndDate, err = parseDate(params, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !sawCalendar {
+		return nil, errors.New("not an iCalendar document")
+	}
+	if current != nil {
+		return nil, errors.New("unterminated VEVENT")
+	}
+
+	return events, nil
+}
+
+// unfold joins continuation lines (those starting with a space or tab) onto the previous line
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// splitProperty splits "NAME;PARAM=X:value" into its name, parameters and value
+func splitProperty(line string) (string, map[string]string, string) {
+	params := make(map[string]string)
+
+	head, value, found := strings.Cut(line, ":")
+	if !found {
+		return strings.ToUpper(line), params, ""
+	}
+
+	parts := strings.Split(head, ";")
+	for _, part := range parts[1:] {
+		key, val, _ := strings.Cut(part, "=")
+		params[strings.ToUpper(key)] = val
+	}
+
+	return strings.ToUpper(parts[0]), params, value
+}
+
+// parseDate reads a DATE or DATE-TIME value and truncates it to a calendar day
+func parseDate(params map[string]string, value string) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		return time.Parse(dateLayout, value)
+	}
+
+	location := time.UTC
+	if tzid, ok := params["TZID"]; ok {
+		loaded, err := time.LoadLocation(tzid)
+		if err == nil {
+			location = loaded
+		}
+	}
+
+	var parsed time.Time
+	var err error
+	if strings.HasSuffix(value, "Z") {
+		parsed, err = time.Parse(dateTimeLayout, strings.TrimSuffix(value, "Z"))
+	} else {
+		parsed, err = time.ParseInLocation(dateTimeLayout, value, location)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+func unescape(value string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(value)
+}
@@ -0,0 +1,73 @@
+package ical
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	file, err := os.Open("testdata/bookings.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	events, err := Parse(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	first := events[0]
+	if first.UID != "booking-1@channel.example" {
+		t.Errorf("wrong uid: %s", first.UID)
+	}
+	if !first.StartDate.Equal(time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong start date: %s", first.StartDate)
+	}
+	if !first.EndDate.Equal(time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong end date: %s", first.EndDate)
+	}
+	if first.Summary != "Reserved, guest A" {
+		t.Errorf("summary not unescaped: %s", first.Summary)
+	}
+
+	second := events[1]
+	if second.Summary != "Reserved guest B" {
+		t.Errorf("folded summary not joined: %s", second.Summary)
+	}
+	if !second.StartDate.Equal(time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date-time not truncated to a day: %s", second.StartDate)
+	}
+
+	if !events[2].Cancelled {
+		t.Error("cancelled event not marked as cancelled")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	file, err := os.Open("testdata/missing-uid.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_, err = Parse(file)
+	if err == nil {
+		t.Error("event without UID parsed without error")
+	}
+
+	_, err = Parse(strings.NewReader("<html></html>"))
+	if err == nil {
+		t.Error("non-calendar document parsed without error")
+	}
+}
@@ -0,0 +1,182 @@
+package ical
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Sync log statuses
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// Syncer fetches external iCalendar feeds and mirrors their events as room restrictions
+type Syncer struct {
+	App    *config.AppConfig
+	DB     repository.DatabaseRepo
+	Client *http.Client
+}
+
+func NewSyncer(a *config.AppConfig, db repository.DatabaseRepo) *Syncer {
+	return &Syncer{
+		App:    a,
+		DB:     db,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Run synchronizes all feeds every interval until ctx is cancelled
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.SyncAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncAll synchronizes every configured feed, logging failures without stopping
+func (s *Syncer) SyncAll(ctx context.Context) {
+	feeds, err := s.DB.AllICalFeeds(ctx)
+	if err != nil {
+		s.App.Logger.ErrorContext(ctx, "cannot load ical feeds", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, feed := range feeds {
+		_, err := s.SyncFeed(ctx, feed)
+		if err != nil {
+			s.App.Logger.ErrorContext(ctx, "ical feed sync failed",
+				slog.Int("feed_id", feed.ID),
+				slog.String("url", feed.URL),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// SyncFeed fetches one feed and creates, updates or removes its external restrictions
+// so that they match the feed's events. The outcome is stored as a sync log entry.
+func (s *Syncer) SyncFeed(ctx context.Context, feed models.RoomICalFeed) (models.ICalSyncLog, error) {
+	result := models.ICalSyncLog{
+		FeedID: feed.ID,
+		Status: StatusOK,
+	}
+
+	err := s.apply(ctx, feed, &result)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Message = err.Error()
+	}
+
+	logErr := s.DB.InsertICalSyncLog(ctx, result)
+	if logErr != nil {
+		s.App.Logger.ErrorContext(ctx, "cannot write ical sync log", slog.String("error", logErr.Error()))
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	err = s.DB.UpdateICalFeedSyncedAt(ctx, feed.ID, time.Now())
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (s *Syncer) apply(ctx context.Context, feed models.RoomICalFeed, result *models.ICalSyncLog) error {
+	events, err := s.fetch(ctx, feed.URL)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]Event)
+	for _, event := range events {
+		if event.Cancelled || !event.EndDate.After(event.StartDate) {
+			continue
+		}
+		wanted[event.UID] = event
+	}
+
+	existing, err := s.DB.ExternalRestrictionsByFeedID(ctx, feed.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, restriction := range existing {
+		event, ok := wanted[restriction.ExternalUID]
+		if !ok {
+			err = s.DB.DeleteRoomRestriction(ctx, restriction.ID)
+			if err != nil {
+				return err
+			}
+			result.Removed++
+			continue
+		}
+
+		delete(wanted, restriction.ExternalUID)
+
+		if event.StartDate.Equal(restriction.StartDate) && event.EndDate.Equal(restriction.EndDate) {
+			continue
+		}
+
+		err = s.DB.UpdateRoomRestrictionDates(ctx, restriction.ID, event.StartDate, event.EndDate)
+		if err != nil {
+			return err
+		}
+		result.Updated++
+	}
+
+	for uid, event := range wanted {
+		err = s.DB.InsertExternalRestriction(ctx, models.RoomRestriction{
+			StartDate:     event.StartDate,
+			EndDate:       event.EndDate,
+			RoomID:        feed.RoomID,
+			RestrictionID: models.RestrictionExternal,
+			FeedID:        feed.ID,
+			ExternalUID:   uid,
+		})
+		if err != nil {
+			return err
+		}
+		result.Added++
+	}
+
+	return nil
+}
+
+func (s *Syncer) fetch(ctx context.Context, url string) ([]Event, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	return Parse(resp.Body)
+}
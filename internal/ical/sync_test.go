@@ -0,0 +1,146 @@
+package ical
+
+import (
+	"context"
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/logging"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"github.com/Sunpacker/go-booking-app/internal/repository/dbrepo"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// restrictionsRepo keeps external restrictions and sync logs in memory,
+// falling back to the test repo for everything else
+type restrictionsRepo struct {
+	repository.DatabaseRepo
+	nextID       int
+	restrictions map[int]models.RoomRestriction
+	logs         []models.ICalSyncLog
+}
+
+func newRestrictionsRepo(a *config.AppConfig) *restrictionsRepo {
+	return &restrictionsRepo{
+		DatabaseRepo: dbrepo.NewTestRepo(a),
+		restrictions: make(map[int]models.RoomRestriction),
+	}
+}
+
+func (m *restrictionsRepo) ExternalRestrictionsByFeedID(ctx context.Context, feedID int) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+	for _, r := range m.restrictions {
+		if r.FeedID == feedID {
+			restrictions = append(restrictions, r)
+		}
+	}
+	return restrictions, nil
+}
+func (m *restrictionsRepo) InsertExternalRestriction(ctx context.Context, r models.RoomRestriction) error {
+	m.nextID++
+	r.ID = m.nextID
+	m.restrictions[r.ID] = r
+	return nil
+}
+func (m *restrictionsRepo) UpdateRoomRestrictionDates(ctx context.Context, id int, start, end time.Time) error {
+	r := m.restrictions[id]
+	r.StartDate = start
+	r.EndDate = end
+	m.restrictions[id] = r
+	return nil
+}
+func (m *restrictionsRepo) DeleteRoomRestriction(ctx context.Context, id int) error {
+	delete(m.restrictions, id)
+	return nil
+}
+func (m *restrictionsRepo) InsertICalSyncLog(ctx context.Context, log models.ICalSyncLog) error {
+	m.logs = append(m.logs, log)
+	return nil
+}
+
+func (m *restrictionsRepo) byUID(uid string) (models.RoomRestriction, bool) {
+	for _, r := range m.restrictions {
+		if r.ExternalUID == uid {
+			return r, true
+		}
+	}
+	return models.RoomRestriction{}, false
+}
+
+func TestSyncer_SyncFeed(t *testing.T) {
+	fixture := "testdata/bookings.ics"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken.ics" {
+			http.Error(w, "gone", http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, fixture)
+	}))
+	defer server.Close()
+
+	app := config.AppConfig{
+		Logger: logging.New(os.Stdout, false, slog.LevelInfo),
+	}
+	repo := newRestrictionsRepo(&app)
+	syncer := NewSyncer(&app, repo)
+	feed := models.RoomICalFeed{ID: 1, RoomID: 2, URL: server.URL + "/room.ics"}
+
+	// first sync creates a restriction for every active event
+	result, err := syncer.SyncFeed(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 2 || result.Updated != 0 || result.Removed != 0 {
+		t.Errorf("first sync: got +%d ~%d -%d, wanted +2 ~0 -0", result.Added, result.Updated, result.Removed)
+	}
+	if _, ok := repo.byUID("booking-3@channel.example"); ok {
+		t.Error("cancelled event was imported")
+	}
+	if r, _ := repo.byUID("booking-2@channel.example"); r.RoomID != 2 || r.RestrictionID != models.RestrictionExternal {
+		t.Errorf("restriction not linked to room 2 as external: %+v", r)
+	}
+
+	// second sync with the same feed changes nothing
+	result, err = syncer.SyncFeed(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 0 || result.Updated != 0 || result.Removed != 0 {
+		t.Errorf("repeated sync: got +%d ~%d -%d, wanted no changes", result.Added, result.Updated, result.Removed)
+	}
+
+	// a moved booking is updated, a dropped one removed and a new one added
+	fixture = "testdata/bookings-changed.ics"
+	result, err = syncer.SyncFeed(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 1 || result.Updated != 1 || result.Removed != 1 {
+		t.Errorf("changed sync: got +%d ~%d -%d, wanted +1 ~1 -1", result.Added, result.Updated, result.Removed)
+	}
+	if r, _ := repo.byUID("booking-1@channel.example"); r.StartDate.Day() != 11 {
+		t.Errorf("moved booking not updated: %s", r.StartDate)
+	}
+
+	// a failing feed is logged and leaves restrictions untouched
+	before := len(repo.restrictions)
+	_, err = syncer.SyncFeed(context.Background(), models.RoomICalFeed{ID: 1, RoomID: 2, URL: server.URL + "/broken.ics"})
+	if err == nil {
+		t.Error("broken feed synced without error")
+	}
+	if len(repo.restrictions) != before {
+		t.Error("broken feed changed restrictions")
+	}
+
+	last := repo.logs[len(repo.logs)-1]
+	if last.Status != StatusFailed || last.Message == "" {
+		t.Errorf("failure not recorded in sync log: %+v", last)
+	}
+	if len(repo.logs) != 4 {
+		t.Errorf("expected 4 sync log entries, got %d", len(repo.logs))
+	}
+}
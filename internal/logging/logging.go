@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// New returns a logger writing to w, as JSON lines for log collectors or as readable text otherwise.
+// Records logged with a request's context carry the attributes collected for that request.
+func New(w io.Writer, json bool, level slog.Leveler) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if json {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+
+	return slog.New(contextHandler{handler})
+}
+
+// contextHandler adds the request attributes found in the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.AddAttrs(Attrs(ctx)...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestAttrs is shared by all contexts derived from the one of NewContext, so attributes added
+// deep down a request, such as the user, are seen by the middleware that logs it
+type requestAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type contextKey string
+
+const attrsContextKey = contextKey("attrs")
+
+// NewContext returns a copy of ctx that collects attributes for the request
+func NewContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, attrsContextKey, &requestAttrs{})
+}
+
+// AddAttrs adds attrs to the attributes of the request in ctx. Without NewContext they are dropped.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	collected, ok := ctx.Value(attrsContextKey).(*requestAttrs)
+	if !ok {
+		return
+	}
+
+	collected.mu.Lock()
+	defer collected.mu.Unlock()
+	collected.attrs = append(collected.attrs, attrs...)
+}
+
+// Attrs returns the attributes collected for the request in ctx
+func Attrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	collected, ok := ctx.Value(attrsContextKey).(*requestAttrs)
+	if !ok {
+		return nil
+	}
+
+	collected.mu.Lock()
+	defer collected.mu.Unlock()
+	return append([]slog.Attr(nil), collected.attrs...)
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, true, slog.LevelInfo)
+
+	logger.Debug("hidden")
+	logger.Info("shown", "room", 1)
+
+	var record map[string]interface{}
+	err := json.Unmarshal(out.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("expected one JSON line, got %q", out.String())
+	}
+	if record["msg"] != "shown" || record["room"] != 1.0 {
+		t.Errorf("wrong record: %v", record)
+	}
+
+	out.Reset()
+	New(&out, false, slog.LevelInfo).Info("shown")
+	if !strings.Contains(out.String(), "msg=shown") {
+		t.Errorf("expected text output, got %q", out.String())
+	}
+}
+
+func TestRequestAttrs(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, true, slog.LevelInfo)
+
+	ctx := NewContext(context.Background())
+	AddAttrs(ctx, slog.String("request_id", "abc"))
+
+	// attributes added through a derived context belong to the same request
+	derived := context.WithValue(ctx, contextKey("other"), true)
+	AddAttrs(derived, slog.Int("user_id", 7))
+
+	logger.With("component", "test").InfoContext(ctx, "hello")
+
+	var record map[string]interface{}
+	err := json.Unmarshal(out.Bytes(), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record["request_id"] != "abc" || record["user_id"] != 7.0 || record["component"] != "test" {
+		t.Errorf("request attributes missing: %v", record)
+	}
+
+	// without NewContext there is nothing to add to
+	plain := context.Background()
+	AddAttrs(plain, slog.String("request_id", "lost"))
+	if len(Attrs(plain)) != 0 {
+		t.Error("attributes kept without a request context")
+	}
+}
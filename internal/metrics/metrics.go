@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"github.com/Sunpacker/go-booking-app/internal/driver"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "booking"
+
+// Metrics holds the collectors of one server and the registry they are served from. Every server
+// gets its own, kept apart from the default registry, so only what it registers is exposed and
+// several servers in one process neither clash nor count each other's requests.
+type Metrics struct {
+	registry      *prometheus.Registry
+	httpRequests  *prometheus.CounterVec
+	httpDuration  *prometheus.HistogramVec
+	queryDuration *prometheus.HistogramVec
+
+	// ReservationsCreated counts reservations guests have made
+	ReservationsCreated prometheus.Counter
+	// AvailabilitySearches counts searches for free rooms by whether any was found
+	AvailabilitySearches *prometheus.CounterVec
+	// FailedLogins counts rejected passwords and two-factor codes
+	FailedLogins prometheus.Counter
+}
+
+// New returns the metrics of a server, registered together with those of the Go runtime
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern, method and status code.",
+		}, []string{"route", "method", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to answer HTTP requests by route pattern and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Time taken by repository methods, errors included.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 3},
+		}, []string{"method"}),
+		ReservationsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reservations_created_total",
+			Help:      "Reservations made by guests.",
+		}),
+		AvailabilitySearches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "availability_searches_total",
+			Help:      "Availability searches by result, available or unavailable.",
+		}, []string{"result"}),
+		FailedLogins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_logins_total",
+			Help:      "Login attempts rejected for a wrong password or two-factor code.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.queryDuration,
+		m.ReservationsCreated,
+		m.AvailabilitySearches,
+		m.FailedLogins,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB exposes the connection pool stats of db along with the metrics
+func (m *Metrics) RegisterDB(db *driver.DB) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db.SQL, namespace))
+}
+
+// Middleware counts and times requests by their chi route pattern, like /admin/reservations/{src}/{id},
+// so that IDs in paths do not each make a series of their own. Requests no route matched share one.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		// the pattern is only known once the router has matched the request
+		route := "unmatched"
+		if routeContext := chi.RouteContext(r.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+			route = routeContext.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		m.httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveQuery records how long the repository method took since start, as in
+//
+//	defer m.ObserveQuery("GetRoomByID", time.Now())
+func (m *Metrics) ObserveQuery(method string, start time.Time) {
+	m.queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// SearchResult is the result label of AvailabilitySearches
+func SearchResult(available bool) string {
+	if available {
+		return "available"
+	}
+	return "unavailable"
+}
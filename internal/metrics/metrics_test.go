@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("metrics answered %d", rr.Code)
+	}
+	return rr.Body.String()
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	mux := chi.NewRouter()
+	mux.Use(m.Middleware)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Post("/reservations/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusSeeOther)
+		})
+	})
+
+	for _, path := range []string{"/rooms/1", "/rooms/2", "/missing"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/admin/reservations/7", nil))
+
+	body := scrape(t, m)
+	for _, expected := range []string{
+		`booking_http_requests_total{method="GET",route="/rooms/{id}",status="200"} 2`,
+		`booking_http_requests_total{method="POST",route="/admin/reservations/{id}",status="303"} 1`,
+		`booking_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`booking_http_request_duration_seconds_count{method="GET",route="/rooms/{id}"} 2`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("missing %s", expected)
+		}
+	}
+}
+
+func TestObserveQuery(t *testing.T) {
+	m := New()
+	m.ObserveQuery("GetRoomByID", time.Now().Add(-10*time.Millisecond))
+	m.ReservationsCreated.Inc()
+	m.AvailabilitySearches.WithLabelValues(SearchResult(false)).Inc()
+
+	body := scrape(t, m)
+	for _, expected := range []string{
+		`booking_db_query_duration_seconds_count{method="GetRoomByID"} 1`,
+		`booking_db_query_duration_seconds_bucket{method="GetRoomByID",le="0.005"} 0`,
+		`booking_reservations_created_total 1`,
+		`booking_availability_searches_total{result="unavailable"} 1`,
+		`booking_failed_logins_total 0`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("missing %s", expected)
+		}
+	}
+}
+
+func TestNew_Independent(t *testing.T) {
+	first, second := New(), New()
+	first.FailedLogins.Inc()
+	first.ObserveQuery("GetRoomByID", time.Now())
+
+	for name, e := range map[string]struct {
+		m        *Metrics
+		expected string
+	}{
+		"first":  {first, "booking_failed_logins_total 1"},
+		"second": {second, "booking_failed_logins_total 0"},
+	} {
+		body := scrape(t, e.m)
+		if !strings.Contains(body, e.expected) {
+			t.Errorf("%s: missing %s", name, e.expected)
+		}
+		if counted := strings.Contains(body, `method="GetRoomByID"`); counted != (e.m == first) {
+			t.Errorf("%s: expected the query to be counted to be %t", name, e.m == first)
+		}
+	}
+}
@@ -1,23 +1,86 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// The json tags are what JSON clients get from render.Respond. Passwords, secrets
+// and login bookkeeping are never sent.
 
 type User struct {
-	ID          int
-	FirstName   string
-	LastName    string
-	Email       string
-	Password    string
-	AccessLevel int
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID          int       `json:"id"`
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	Email       string    `json:"email"`
+	Password    string    `json:"-"`
+	AccessLevel int       `json:"access_level"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Active is false for deactivated users, who cannot log in
+	Active bool `json:"active"`
+
+	// SessionVersion changes whenever existing sessions of the user must stop working
+	SessionVersion int `json:"-"`
+
+	// FailedLogins counts consecutive failed logins since the last successful one
+	FailedLogins      int       `json:"-"`
+	LastFailedLoginAt time.Time `json:"-"`
+	LockedUntil       time.Time `json:"-"`
+
+	// TOTPSecret is set once enrollment starts; TOTPEnabled only after the first code was verified
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"two_factor"`
+	TOTPLastStep int64  `json:"-"`
+}
+
+// Access levels of users
+const (
+	AccessLevelStaff   = 1
+	AccessLevelManager = 2
+	AccessLevelAdmin   = 3
+)
+
+// AccessLevelNames are the labels of the access levels, in ascending order of rights
+var AccessLevelNames = map[int]string{
+	AccessLevelStaff:   "Staff",
+	AccessLevelManager: "Manager",
+	AccessLevelAdmin:   "Administrator",
+}
+
+// IsManager reports whether the user has manager rights or more
+func (u User) IsManager() bool {
+	return u.AccessLevel >= AccessLevelManager
+}
+
+// IsAdmin reports whether the user can manage other users
+func (u User) IsAdmin() bool {
+	return u.AccessLevel >= AccessLevelAdmin
+}
+
+// AccessLevelName returns the label of the user's access level
+func (u User) AccessLevelName() string {
+	if name, ok := AccessLevelNames[u.AccessLevel]; ok {
+		return name
+	}
+	return "Unknown"
 }
 
+// IsLocked reports whether the account is temporarily locked at now
+func (u User) IsLocked(now time.Time) bool {
+	return u.LockedUntil.After(now)
+}
+
+// Room leaves its timestamps out of JSON, since rooms joined to other rows are loaded without them
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        int       `json:"id"`
+	RoomName  string    `json:"room_name"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+
+	// NightlyRate is the price of one night in cents
+	NightlyRate int `json:"nightly_rate,omitempty"`
 }
 
 type Restriction struct {
@@ -28,18 +91,35 @@ type Restriction struct {
 }
 
 type Reservation struct {
-	ID        int
-	FirstName string
-	LastName  string
-	Email     string
-	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
-	RoomID    int
-	Room      Room
-	Processed int
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        int       `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	RoomID    int       `json:"room_id"`
+	Room      Room      `json:"room"`
+	Processed int       `json:"processed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ConfirmationCode string `json:"confirmation_code"`
+}
+
+// MarshalJSON writes the arrival and departure as plain dates, the way they are entered
+func (r Reservation) MarshalJSON() ([]byte, error) {
+	// reservation has the fields of Reservation without its methods, so it marshals the default way
+	type reservation Reservation
+	return json.Marshal(struct {
+		reservation
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}{
+		reservation: reservation(r),
+		StartDate:   r.StartDate.Format("2006-01-02"),
+		EndDate:     r.EndDate.Format("2006-01-02"),
+	})
 }
 
 type RoomRestriction struct {
@@ -50,8 +130,74 @@ type RoomRestriction struct {
 	Room          Room
 	ReservationID int
 	RestrictionID int
+	FeedID        int
+	ExternalUID   string
 	Restriction   Restriction
 	Reservation   Reservation
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
+
+// Restriction types stored in the restrictions table
+const (
+	RestrictionReservation = 1
+	RestrictionExternal    = 2
+)
+
+// Reservation statuses accepted by ReservationFilter
+const (
+	ReservationStatusNew       = "new"
+	ReservationStatusProcessed = "processed"
+)
+
+// ReservationFilter narrows down reservation listings; zero values mean "any"
+type ReservationFilter struct {
+	StartDate time.Time
+	EndDate   time.Time
+	RoomID    int
+	Status    string
+	Search    string
+}
+
+// RoomICalFeed is an external iCalendar URL whose events block a room
+type RoomICalFeed struct {
+	ID           int
+	RoomID       int
+	Room         Room
+	URL          string
+	LastSyncedAt time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// ICalSyncLog records the outcome of a single feed synchronization
+type ICalSyncLog struct {
+	ID        int
+	FeedID    int
+	Status    string
+	Message   string
+	Added     int
+	Updated   int
+	Removed   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// LoginEvent records a single login attempt for review; UserID is zero for unknown emails
+type LoginEvent struct {
+	ID        int
+	UserID    int
+	Email     string
+	IPAddress string
+	Success   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// MailData is an email queued on AppConfig.MailChan
+type MailData struct {
+	To      string
+	From    string
+	Subject string
+	Content string
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReservation_MarshalJSON(t *testing.T) {
+	reservation := Reservation{
+		ID:        7,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Room:      Room{ID: 1, RoomName: "General's Quarters"},
+	}
+
+	out, err := json.Marshal(reservation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{`"id":7`, `"start_date":"2050-01-01"`, `"end_date":"2050-01-03"`, `"room":{"id":1,"room_name":"General's Quarters"}`} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected %s in %s", expected, out)
+		}
+	}
+}
+
+func TestUser_JSONLeavesOutSecrets(t *testing.T) {
+	out, err := json.Marshal(User{ID: 1, Password: "hash", TOTPSecret: "JBSWY3DPEHPK3PXP", TOTPEnabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(out), "hash") || strings.Contains(string(out), "JBSWY3DPEHPK3PXP") {
+		t.Errorf("secrets in %s", out)
+	}
+	if !strings.Contains(string(out), `"two_factor":true`) {
+		t.Errorf("expected two_factor in %s", out)
+	}
+}
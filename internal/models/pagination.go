@@ -0,0 +1,137 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Sort directions accepted by ReservationQuery
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ReservationQuery describes one page of a filtered and sorted reservation listing
+type ReservationQuery struct {
+	ReservationFilter
+	Page      int
+	PageSize  int
+	Sort      string
+	Direction string
+}
+
+// Offset returns the number of rows to skip before the requested page
+func (q ReservationQuery) Offset() int {
+	return (q.Page - 1) * q.PageSize
+}
+
+// Pagination holds what list templates need to render page controls and sortable headers
+type Pagination struct {
+	Path      string     `json:"-"`
+	Query     url.Values `json:"-"`
+	Page      int        `json:"page"`
+	PageSize  int        `json:"per_page"`
+	Total     int        `json:"total"`
+	Sort      string     `json:"sort"`
+	Direction string     `json:"dir"`
+}
+
+// NewPagination builds page controls for path, keeping the filters found in query
+func NewPagination(path string, query url.Values, spec ReservationQuery, total int) *Pagination {
+	return &Pagination{
+		Path:      path,
+		Query:     query,
+		Page:      spec.Page,
+		PageSize:  spec.PageSize,
+		Total:     total,
+		Sort:      spec.Sort,
+		Direction: spec.Direction,
+	}
+}
+
+func (p *Pagination) TotalPages() int {
+	if p.PageSize <= 0 || p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+func (p *Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p *Pagination) HasNext() bool {
+	return p.Page < p.TotalPages()
+}
+
+func (p *Pagination) PrevPage() int {
+	if !p.HasPrev() {
+		return 1
+	}
+	return p.Page - 1
+}
+
+func (p *Pagination) NextPage() int {
+	if !p.HasNext() {
+		return p.TotalPages()
+	}
+	return p.Page + 1
+}
+
+// Pages returns the page numbers shown around the current page
+func (p *Pagination) Pages() []int {
+	first := p.Page - 2
+	if first < 1 {
+		first = 1
+	}
+	last := first + 4
+	if last > p.TotalPages() {
+		last = p.TotalPages()
+	}
+
+	var pages []int
+	for page := first; page <= last; page++ {
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// PageURL links to another page with the same filters and sorting
+func (p *Pagination) PageURL(page int) string {
+	query := p.copyQuery()
+	query.Set("page", strconv.Itoa(page))
+	return p.Path + "?" + query.Encode()
+}
+
+// SortURL links to the first page sorted by column, flipping the direction if it is already sorted by it
+func (p *Pagination) SortURL(column string) string {
+	direction := SortAsc
+	if p.Sort == column && p.Direction == SortAsc {
+		direction = SortDesc
+	}
+
+	query := p.copyQuery()
+	query.Del("page")
+	query.Set("sort", column)
+	query.Set("dir", direction)
+	return p.Path + "?" + query.Encode()
+}
+
+// SortIndicator returns an arrow for the column the list is currently sorted by
+func (p *Pagination) SortIndicator(column string) string {
+	if p.Sort != column {
+		return ""
+	}
+	if p.Direction == SortDesc {
+		return "▼"
+	}
+	return "▲"
+}
+
+func (p *Pagination) copyQuery() url.Values {
+	query := url.Values{}
+	for key, values := range p.Query {
+		query[key] = append([]string(nil), values...)
+	}
+	return query
+}
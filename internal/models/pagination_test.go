@@ -0,0 +1,42 @@
+package models
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPagination(t *testing.T) {
+	query, _ := url.ParseQuery("q=smith&page=2")
+	spec := ReservationQuery{Page: 2, PageSize: 20, Sort: "last_name", Direction: SortAsc}
+
+	pagination := NewPagination("/admin/reservations-all", query, spec, 95)
+
+	if pagination.TotalPages() != 5 {
+		t.Errorf("expected 5 pages, got %d", pagination.TotalPages())
+	}
+	if !pagination.HasPrev() || !pagination.HasNext() {
+		t.Error("page 2 of 5 should have previous and next pages")
+	}
+	if len(pagination.Pages()) != 5 {
+		t.Errorf("expected 5 page links, got %v", pagination.Pages())
+	}
+
+	if got := pagination.PageURL(3); got != "/admin/reservations-all?page=3&q=smith" {
+		t.Errorf("wrong page url: %s", got)
+	}
+	if got := pagination.SortURL("last_name"); got != "/admin/reservations-all?dir=desc&q=smith&sort=last_name" {
+		t.Errorf("sorting by the current column should flip direction and reset page: %s", got)
+	}
+	if pagination.SortIndicator("room") != "" || pagination.SortIndicator("last_name") == "" {
+		t.Error("sort indicator shown for the wrong column")
+	}
+
+	if query.Get("page") != "2" {
+		t.Error("building urls modified the original query")
+	}
+
+	empty := NewPagination("/", url.Values{}, ReservationQuery{Page: 1, PageSize: 20}, 0)
+	if empty.TotalPages() != 1 || empty.HasNext() {
+		t.Error("an empty list should have exactly one page")
+	}
+}
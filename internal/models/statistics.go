@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// DashboardStats holds the headline numbers shown on the admin dashboard
+type DashboardStats struct {
+	ArrivalsToday   int
+	DeparturesToday int
+	OccupiedRooms   int
+	TotalRooms      int
+	Unprocessed     int
+}
+
+// OccupancyPercent returns the share of rooms occupied today
+func (s DashboardStats) OccupancyPercent() int {
+	if s.TotalRooms == 0 {
+		return 0
+	}
+	return s.OccupiedRooms * 100 / s.TotalRooms
+}
+
+// RoomOccupancy is how many nights of a period a room was blocked, by reservations or external bookings
+type RoomOccupancy struct {
+	Room         Room
+	BookedNights int
+	Nights       int
+}
+
+func (o RoomOccupancy) Percent() int {
+	if o.Nights == 0 {
+		return 0
+	}
+	return o.BookedNights * 100 / o.Nights
+}
+
+// MonthlyRevenue is the value of reservations arriving in a month, in cents
+type MonthlyRevenue struct {
+	Month   time.Time
+	Revenue int
+}
+
+func (m MonthlyRevenue) Label() string {
+	return m.Month.Format("Jan 2006")
+}
+
+// Amount formats the revenue as a decimal number with two digits after the point
+func (m MonthlyRevenue) Amount() string {
+	return fmt.Sprintf("%d.%02d", m.Revenue/100, m.Revenue%100)
+}
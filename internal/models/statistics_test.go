@@ -0,0 +1,20 @@
+package models
+
+import "testing"
+
+func TestStatistics(t *testing.T) {
+	if got := (MonthlyRevenue{Revenue: 123405}).Amount(); got != "1234.05" {
+		t.Errorf("wrong amount: %s", got)
+	}
+
+	if got := (RoomOccupancy{BookedNights: 15, Nights: 30}).Percent(); got != 50 {
+		t.Errorf("wrong occupancy percent: %d", got)
+	}
+	if got := (RoomOccupancy{}).Percent(); got != 0 {
+		t.Errorf("empty period should have 0%% occupancy, got %d", got)
+	}
+
+	if got := (DashboardStats{OccupiedRooms: 1, TotalRooms: 4}).OccupancyPercent(); got != 25 {
+		t.Errorf("wrong dashboard occupancy: %d", got)
+	}
+}
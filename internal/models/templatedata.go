@@ -14,4 +14,9 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	// User is the logged-in user, the zero User for visitors
+	User User
+	// Locale is the language the page is shown in, Locales the ones it can be switched to
+	Locale  string
+	Locales []string
 }
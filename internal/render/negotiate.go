@@ -0,0 +1,88 @@
+package render
+
+import (
+	"encoding/json"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errorPayload is the JSON body of a failed request
+type errorPayload struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// WantsJSON reports whether the Accept header prefers JSON over HTML.
+// Browsers, wildcards and a missing header all get HTML.
+func WantsJSON(r *http.Request) bool {
+	var jsonQuality, htmlQuality float64
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			jsonQuality = max(jsonQuality, quality)
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			htmlQuality = max(htmlQuality, quality)
+		}
+	}
+
+	return jsonQuality > htmlQuality
+}
+
+// Negotiate reports whether to answer r with JSON, as WantsJSON does, and marks the response as
+// depending on the Accept header, so caches do not hand one format to a client asking for the other
+func Negotiate(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Accept")
+	return WantsJSON(r)
+}
+
+// JSON writes v as indented JSON with the given status code
+func JSON(w http.ResponseWriter, status int, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "     ")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(out)
+	return err
+}
+
+// JSONError writes {"ok": false, "message": message} with the given status code
+func JSONError(w http.ResponseWriter, status int, message string) error {
+	return JSON(w, status, errorPayload{
+		Ok:      false,
+		Message: message,
+	})
+}
+
+// Respond answers with templateData.Data as JSON when the client asks for it, and renders tmpl otherwise,
+// so both formats are served from the same data. What goes into JSON is set by the json tags of the models.
+func (re *Renderer) Respond(w http.ResponseWriter, r *http.Request, status int, tmpl string, templateData *models.TemplateData) error {
+	if Negotiate(w, r) {
+		data := templateData.Data
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		return JSON(w, status, data)
+	}
+	return re.TemplateWithStatus(w, r, status, tmpl, templateData)
+}
@@ -0,0 +1,104 @@
+package render
+
+import (
+	"encoding/json"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var wantsJSONTests = []struct {
+	accept   string
+	expected bool
+}{
+	{"", false},
+	{"*/*", false},
+	{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+	{"application/json", true},
+	{"application/json, text/plain, */*", true},
+	{"application/problem+json", true},
+	{"text/html;q=0.5, application/json", true},
+	{"application/json;q=0.5, text/html", false},
+	{"application/json;q=bad", false},
+}
+
+func TestWantsJSON(t *testing.T) {
+	for _, e := range wantsJSONTests {
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept", e.accept)
+
+		if WantsJSON(request) != e.expected {
+			t.Errorf("Accept '%s': expected %v", e.accept, e.expected)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, e := range wantsJSONTests {
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept", e.accept)
+		rr := httptest.NewRecorder()
+
+		if Negotiate(rr, request) != e.expected {
+			t.Errorf("Accept '%s': expected %v", e.accept, e.expected)
+		}
+		if vary := rr.Header().Get("Vary"); vary != "Accept" {
+			t.Errorf("Accept '%s': expected the response to vary on Accept, got '%s'", e.accept, vary)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	err := JSONError(rr, http.StatusBadRequest, "bad dates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("wrong response: %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var payload errorPayload
+	err = json.Unmarshal(rr.Body.Bytes(), &payload)
+	if err != nil || payload.Ok || payload.Message != "bad dates" {
+		t.Errorf("wrong error body: %s", rr.Body.String())
+	}
+}
+
+func TestRespond(t *testing.T) {
+	testApp.TemplateFS = os.DirFS("../../templates")
+	templateCache, err := renderer.CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testApp.TemplateCache = templateCache
+
+	templateData := &models.TemplateData{
+		Data:      map[string]interface{}{"page": "home"},
+		StringMap: map[string]string{"hidden": "only for the template"},
+	}
+
+	request, _ := getRequestWithSession()
+	rr := httptest.NewRecorder()
+	_ = renderer.Respond(rr, request, http.StatusOK, "home", templateData)
+	if !strings.Contains(rr.Body.String(), "<html") {
+		t.Error("browser did not get the html page")
+	}
+	if vary := rr.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("html page does not vary on Accept: '%s'", vary)
+	}
+
+	request.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	_ = renderer.Respond(rr, request, http.StatusOK, "home", templateData)
+	if strings.TrimSpace(rr.Body.String()) != "{\n     \"page\": \"home\"\n}" {
+		t.Errorf("json client got %s", rr.Body.String())
+	}
+	if vary := rr.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("json does not vary on Accept: '%s'", vary)
+	}
+}
@@ -2,101 +2,203 @@ package render
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/helpers"
+	"github.com/Sunpacker/go-booking-app/internal/i18n"
 	"github.com/Sunpacker/go-booking-app/internal/models"
 	"github.com/justinas/nosurf"
 	"html/template"
+	"io/fs"
+	"log/slog"
 	"net/http"
-	"path/filepath"
+	"os"
+	"path"
 	"strings"
 	"time"
 )
 
-var functions = template.FuncMap{
-	"formatDate": FormatDate,
-}
-var templatesFormat = "./templates/%s.tmpl"
+// functions are used while parsing templates; execute swaps in the ones for the request's locale
+var functions = Functions(i18n.DefaultLocale)
+var templatesFormat = "%s.tmpl"
 
-var app *config.AppConfig
+// Renderer renders the templates of one app: its config decides on caching and where templates
+// are read from, and its session holds the messages shown on the next page
+type Renderer struct {
+	App *config.AppConfig
+}
 
-func NewRenderer(a *config.AppConfig) {
-	app = a
+func NewRenderer(a *config.AppConfig) *Renderer {
+	return &Renderer{App: a}
 }
 
-func FormatDate(t time.Time) string {
-	return t.Format("2006-01-02")
+// Functions returns the template functions for locale: t translates a message,
+// formatDate writes a date the way the locale does and languageName names a locale
+func Functions(locale string) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string, args ...interface{}) string {
+			return i18n.T(locale, key, args...)
+		},
+		"formatDate": func(t time.Time) string {
+			return i18n.FormatDate(locale, t)
+		},
+		"languageName": i18n.Name,
+	}
 }
 
-func AddDefaultData(templateData *models.TemplateData, r *http.Request) *models.TemplateData {
-	templateData.Flash = app.Session.PopString(r.Context(), "flash")
-	templateData.Error = app.Session.PopString(r.Context(), "error")
-	templateData.Warning = app.Session.PopString(r.Context(), "warning")
+func (re *Renderer) AddDefaultData(templateData *models.TemplateData, r *http.Request) *models.TemplateData {
+	locale := i18n.FromContext(r.Context())
+
+	templateData.Locale = locale
+	templateData.Locales = i18n.Locales()
+	templateData.Flash = i18n.T(locale, re.App.Session.PopString(r.Context(), "flash"))
+	templateData.Error = i18n.T(locale, re.App.Session.PopString(r.Context(), "error"))
+	templateData.Warning = i18n.T(locale, re.App.Session.PopString(r.Context(), "warning"))
 	templateData.CSRFToken = nosurf.Token(r)
 
-	if app.Session.Exists(r.Context(), "user_id") {
+	if templateData.Form != nil {
+		templateData.Form.Localize(func(format string, args ...interface{}) string {
+			return i18n.T(locale, format, args...)
+		})
+	}
+
+	if user, ok := helpers.CurrentUser(r); ok {
 		templateData.IsAuthenticated = 1
+		templateData.User = user
 	}
 	return templateData
 }
 
 // Template renders templates using html
-func Template(w http.ResponseWriter, r *http.Request, tmpl string, templateData *models.TemplateData) error {
-	var templateCache map[string]*template.Template
+func (re *Renderer) Template(w http.ResponseWriter, r *http.Request, tmpl string, templateData *models.TemplateData) error {
+	return re.TemplateWithStatus(w, r, http.StatusOK, tmpl, templateData)
+}
 
-	if app.UseCache {
-		templateCache = app.TemplateCache
-	} else {
-		templateCache, _ = CreateTemplateCache()
+// TemplateWithStatus renders a template with the given status code. If the template cannot be rendered,
+// the error is logged and answered with a 500: showing the error itself in development,
+// and the styled error page in production.
+func (re *Renderer) TemplateWithStatus(w http.ResponseWriter, r *http.Request, status int, tmpl string, templateData *models.TemplateData) error {
+	templateBuffer, err := re.execute(r, tmpl, templateData)
+	if err != nil {
+		re.renderError(w, r, err)
+		return err
+	}
+
+	w.WriteHeader(status)
+	_, err = templateBuffer.WriteTo(w)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ErrorData returns the template data for the error page
+func ErrorData(status int, message string) *models.TemplateData {
+	intMap := make(map[string]int)
+	intMap["status"] = status
+
+	stringMap := make(map[string]string)
+	stringMap["title"] = http.StatusText(status)
+	stringMap["message"] = message
+
+	return &models.TemplateData{
+		IntMap:    intMap,
+		StringMap: stringMap,
+	}
+}
+
+// execute renders a template into a buffer, so nothing is sent if rendering fails halfway
+func (re *Renderer) execute(r *http.Request, tmpl string, templateData *models.TemplateData) (*bytes.Buffer, error) {
+	templateCache := re.App.TemplateCache
+	if !re.App.UseCache {
+		var err error
+		templateCache, err = re.CreateTemplateCache()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	templateFromCache, ok := templateCache[tmpl]
 	if !ok {
-		return errors.New(fmt.Sprintf("cannot get template '%s' from cache", tmpl))
+		return nil, fmt.Errorf("cannot get template '%s' from cache", tmpl)
 	}
 
-	templateBuffer := new(bytes.Buffer)
-	templateData = AddDefaultData(templateData, r)
-	_ = templateFromCache.Execute(templateBuffer, templateData)
+	// cached templates are never executed themselves, so they can always be cloned
+	localized, err := templateFromCache.Clone()
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := templateBuffer.WriteTo(w)
+	templateBuffer := new(bytes.Buffer)
+	templateData = re.AddDefaultData(templateData, r)
+	err = localized.Funcs(Functions(templateData.Locale)).Execute(templateBuffer, templateData)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("cannot execute template '%s': %w", tmpl, err)
 	}
 
-	return nil
+	return templateBuffer, nil
+}
+
+func (re *Renderer) renderError(w http.ResponseWriter, r *http.Request, err error) {
+	re.App.Logger.ErrorContext(r.Context(), "cannot render page", slog.String("error", err.Error()))
+
+	if !re.App.IsProd {
+		http.Error(w, "template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page, pageErr := re.execute(r, "error", ErrorData(http.StatusInternalServerError,
+		"Something went wrong on our side. Please try again in a moment."))
+	if pageErr != nil {
+		re.App.Logger.ErrorContext(r.Context(), "cannot render error page", slog.String("error", pageErr.Error()))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = page.WriteTo(w)
 }
 
 func getTemplateFilepathPattern(pattern string) string {
 	return fmt.Sprintf(templatesFormat, pattern)
 }
 
-func CreateTemplateCache() (map[string]*template.Template, error) {
+// templateFS returns where templates are read from: the configured file system,
+// or the templates directory on disk if none is set
+func (re *Renderer) templateFS() fs.FS {
+	if re.App.TemplateFS != nil {
+		return re.App.TemplateFS
+	}
+	return os.DirFS("./templates")
+}
+
+func (re *Renderer) CreateTemplateCache() (map[string]*template.Template, error) {
 	templateCache := map[string]*template.Template{}
+	fsys := re.templateFS()
 
 	pagePattern := getTemplateFilepathPattern("*.page")
-	pages, err := filepath.Glob(pagePattern)
+	pages, err := fs.Glob(fsys, pagePattern)
 	if err != nil {
 		return templateCache, err
 	}
 
 	for _, page := range pages {
-		name := filepath.Base(page)
+		name := path.Base(page)
 
-		templateSet, err := template.New(name).Funcs(functions).ParseFiles(page)
+		templateSet, err := template.New(name).Funcs(functions).ParseFS(fsys, page)
 		if err != nil {
 			return templateCache, err
 		}
 
 		layoutPattern := getTemplateFilepathPattern("*.layout")
-		matches, err := filepath.Glob(layoutPattern)
+		matches, err := fs.Glob(fsys, layoutPattern)
 		if err != nil {
 			return templateCache, err
 		}
 
 		if len(matches) > 0 {
-			templateSet, err = templateSet.ParseGlob(layoutPattern)
+			templateSet, err = templateSet.ParseFS(fsys, layoutPattern)
 			if err != nil {
 				return templateCache, err
 			}
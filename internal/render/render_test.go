@@ -3,7 +3,11 @@ package render
 import (
 	"github.com/Sunpacker/go-booking-app/internal/models"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestAddDefaultData(t *testing.T) {
@@ -16,7 +20,7 @@ func TestAddDefaultData(t *testing.T) {
 
 	session.Put(request.Context(), "flash", "123")
 
-	result := AddDefaultData(&templatedata, request)
+	result := renderer.AddDefaultData(&templatedata, request)
 	if result.Flash != "123" {
 		t.Error("flash value of 123 not found in session")
 	}
@@ -35,18 +39,20 @@ func getRequestWithSession() (*http.Request, error) {
 }
 
 func TestNewRenderer(t *testing.T) {
-	NewRenderer(app)
+	if NewRenderer(&testApp).App != &testApp {
+		t.Error("renderer does not use the given config")
+	}
 }
 
 func TestRenderTemplate(t *testing.T) {
-	templatesFormat = "../../templates/%s.tmpl"
+	testApp.TemplateFS = os.DirFS("../../templates")
 
-	templateCache, err := CreateTemplateCache()
+	templateCache, err := renderer.CreateTemplateCache()
 	if err != nil {
 		t.Error(err)
 	}
 
-	app.TemplateCache = templateCache
+	testApp.TemplateCache = templateCache
 
 	request, err := getRequestWithSession()
 	if err != nil {
@@ -55,11 +61,11 @@ func TestRenderTemplate(t *testing.T) {
 
 	var writer skeletonWriter
 
-	err = Template(&writer, request, "home", &models.TemplateData{})
+	err = renderer.Template(&writer, request, "home", &models.TemplateData{})
 	if err != nil {
 		t.Error("[TestRenderTemplate] home rendering error:", err)
 	}
-	err = Template(&writer, request, "non-existent", &models.TemplateData{})
+	err = renderer.Template(&writer, request, "non-existent", &models.TemplateData{})
 	if err == nil {
 		t.Error("[TestRenderTemplate] non-existent template has rendered")
 	}
@@ -68,8 +74,7 @@ func TestRenderTemplate(t *testing.T) {
 type skeletonWriter struct{}
 
 func (w *skeletonWriter) Header() http.Header {
-	var header http.Header
-	return header
+	return http.Header{}
 }
 func (w *skeletonWriter) WriteHeader(statusCode int) {
 	_ = statusCode
@@ -80,10 +85,68 @@ func (w *skeletonWriter) Write(bytes []byte) (int, error) {
 }
 
 func TestCreateTemplateCache(t *testing.T) {
-	templatesFormat = "../../templates/%s.tmpl"
+	testApp.TemplateFS = os.DirFS("../../templates")
 
-	_, err := CreateTemplateCache()
+	_, err := renderer.CreateTemplateCache()
 	if err != nil {
 		t.Error(err)
 	}
 }
+
+func TestCreateTemplateCache_Embedded(t *testing.T) {
+	testApp.TemplateFS = fstest.MapFS{
+		"home.page.tmpl":   {Data: []byte(`{{template "base" .}}{{define "content"}}home{{end}}`)},
+		"base.layout.tmpl": {Data: []byte(`{{define "base"}}<main>{{block "content" .}}{{end}}</main>{{end}}`)},
+		"notes.txt":        {Data: []byte("not a template")},
+	}
+	defer func() {
+		testApp.TemplateFS = nil
+	}()
+
+	templateCache, err := renderer.CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templateCache) != 1 || templateCache["home"] == nil {
+		t.Errorf("expected only the home page in the cache, got %d templates", len(templateCache))
+	}
+}
+
+func TestTemplateWithStatus(t *testing.T) {
+	testApp.TemplateFS = os.DirFS("../../templates")
+	templateCache, err := renderer.CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testApp.TemplateCache = templateCache
+
+	request, _ := getRequestWithSession()
+	rr := httptest.NewRecorder()
+	err = renderer.TemplateWithStatus(rr, request, http.StatusNotFound, "error", ErrorData(http.StatusNotFound, "gone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "gone") {
+		t.Errorf("error page not rendered with 404, got %d", rr.Code)
+	}
+
+	// development shows what went wrong
+	rr = httptest.NewRecorder()
+	_ = renderer.Template(rr, request, "non-existent", &models.TemplateData{})
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "non-existent") {
+		t.Errorf("missing template not reported in development: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// production shows the styled error page without details
+	testApp.IsProd = true
+	defer func() {
+		testApp.IsProd = false
+	}()
+
+	rr = httptest.NewRecorder()
+	_ = renderer.Template(rr, request, "non-existent", &models.TemplateData{})
+	if rr.Code != http.StatusInternalServerError || strings.Contains(rr.Body.String(), "non-existent") ||
+		!strings.Contains(rr.Body.String(), "Something went wrong") {
+		t.Errorf("missing template not answered with the error page in production: %d", rr.Code)
+	}
+}
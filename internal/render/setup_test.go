@@ -2,8 +2,9 @@ package render
 
 import (
 	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/logging"
 	"github.com/alexedwards/scs/v2"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
@@ -12,6 +13,7 @@ import (
 
 var session *scs.SessionManager
 var testApp config.AppConfig
+var renderer *Renderer
 
 func TestMain(m *testing.M) {
 	session = scs.New()
@@ -22,9 +24,8 @@ func TestMain(m *testing.M) {
 
 	testApp.Session = session
 	testApp.UseCache = true
-	testApp.InfoLog = log.New(os.Stdout, "[INFO]\t", log.Ldate|log.Ltime)
-	testApp.ErrorLog = log.New(os.Stdout, "[ERROR]\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app = &testApp
+	testApp.Logger = logging.New(os.Stdout, false, slog.LevelInfo)
+	renderer = NewRenderer(&testApp)
 
 	os.Exit(m.Run())
 }
@@ -0,0 +1,455 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/driver"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contractEmailDomain marks the users created by the contract, so they can be removed from a real database
+const contractEmailDomain = "@contract.example.com"
+
+// repoContract is the behaviour every repository.DatabaseRepo has to share. Each case gets a repository
+// holding rooms 1 and 2, as the seed migrations create them, and keeps clear of any other data in it.
+var repoContract = []struct {
+	name string
+	test func(*testing.T, repository.DatabaseRepo)
+}{
+	{"availability overlap", testContractAvailability},
+	{"availability for all rooms", testContractAvailabilityForAllRooms},
+	{"reservation lifecycle", testContractReservation},
+	{"unknown rows", testContractUnknownRows},
+	{"authentication", testContractAuthenticate},
+	{"users", testContractUsers},
+	{"dashboard stats", testContractDashboardStats},
+	{"room occupancy", testContractRoomOccupancy},
+}
+
+func runRepoContract(t *testing.T, newRepo func(t *testing.T) repository.DatabaseRepo) {
+	for _, c := range repoContract {
+		t.Run(c.name, func(t *testing.T) {
+			c.test(t, newRepo(t))
+		})
+	}
+}
+
+func TestMemoryRepo_Contract(t *testing.T) {
+	runRepoContract(t, func(t *testing.T) repository.DatabaseRepo {
+		return newMemoryTestRepo()
+	})
+}
+
+// TestPostgresRepo_Contract runs the contract against the migrated database in TEST_DATABASE_DSN,
+// skipping without one
+func TestPostgresRepo_Contract(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := driver.ConnectSQL(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, err := db.SQL.Exec("delete from users where email like $1", "%"+contractEmailDomain)
+		if err != nil {
+			t.Error(err)
+		}
+		_ = db.SQL.Close()
+	})
+
+	runRepoContract(t, func(t *testing.T) repository.DatabaseRepo {
+		return NewPostgresRepo(db.SQL, &config.AppConfig{})
+	})
+}
+
+// contractDay returns a day far enough ahead not to meet existing bookings
+func contractDay(day int) time.Time {
+	return time.Date(2090, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, day)
+}
+
+// book reserves room from start to end and removes the reservation when the test ends
+func book(t *testing.T, repo repository.DatabaseRepo, roomID int, start, end time.Time) int {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "Contract",
+		LastName:  "Guest",
+		Email:     "guest" + contractEmailDomain,
+		Phone:     "+15555555555",
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    roomID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = repo.DeleteReservation(context.Background(), id)
+	})
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		RoomID:        roomID,
+		ReservationID: id,
+		RestrictionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// a stay may start on the day another one ends, and end on the day another one starts
+var availabilityTests = []struct {
+	name      string
+	roomID    int
+	start     int
+	end       int
+	available bool
+}{
+	{"same dates", 1, 10, 13, false},
+	{"inside", 1, 11, 12, false},
+	{"enclosing", 1, 9, 14, false},
+	{"overlapping arrival", 1, 8, 11, false},
+	{"overlapping departure", 1, 12, 15, false},
+	{"departing on arrival day", 1, 7, 10, true},
+	{"arriving on departure day", 1, 13, 15, true},
+	{"other room", 2, 10, 13, true},
+}
+
+func testContractAvailability(t *testing.T, repo repository.DatabaseRepo) {
+	book(t, repo, 1, contractDay(10), contractDay(13))
+
+	for _, e := range availabilityTests {
+		available, err := repo.SearchAvailabilityByDatesByRoomID(context.Background(), contractDay(e.start), contractDay(e.end), e.roomID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if available != e.available {
+			t.Errorf("%s: expected available to be %t", e.name, e.available)
+		}
+	}
+}
+
+func testContractAvailabilityForAllRooms(t *testing.T, repo repository.DatabaseRepo) {
+	book(t, repo, 1, contractDay(20), contractDay(23))
+
+	for _, e := range availabilityTests {
+		if e.roomID != 1 {
+			continue
+		}
+
+		rooms, err := repo.SearchAvailabilityForAllRooms(context.Background(), contractDay(e.start+10), contractDay(e.end+10))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := map[int]bool{}
+		for _, room := range rooms {
+			found[room.ID] = true
+		}
+		if found[1] != e.available || !found[2] {
+			t.Errorf("%s: expected room 1 available to be %t and room 2 to be available, got %v", e.name, e.available, rooms)
+		}
+	}
+}
+
+func testContractReservation(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	start, end := contractDay(30), contractDay(32)
+
+	room, err := repo.GetRoomByID(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := book(t, repo, 2, start, end)
+
+	reservation, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.ID != id || reservation.LastName != "Guest" || reservation.RoomID != 2 ||
+		!reservation.StartDate.Equal(start) || !reservation.EndDate.Equal(end) || reservation.Processed != 0 {
+		t.Errorf("reservation not stored as inserted: %+v", reservation)
+	}
+	if reservation.Room.ID != 2 || reservation.Room.RoomName != room.RoomName {
+		t.Errorf("expected the reservation's room to be %s, got %+v", room.RoomName, reservation.Room)
+	}
+
+	reservation.FirstName = "Updated"
+	reservation.Phone = "+15555550000"
+	// only the guest's details can be changed
+	reservation.RoomID = 1
+	err = repo.UpdateReservation(ctx, reservation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.UpdateProcessedForReservation(ctx, id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.FirstName != "Updated" || updated.Phone != "+15555550000" || updated.RoomID != 2 || updated.Processed != 1 {
+		t.Errorf("reservation not updated: %+v", updated)
+	}
+
+	err = repo.DeleteReservation(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetReservationByID(ctx, id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a deleted reservation, got %v", err)
+	}
+
+	// the restriction goes with the reservation
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, start, end, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("room still blocked after its reservation was deleted")
+	}
+}
+
+func testContractUnknownRows(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	const unknownID = 1 << 30
+
+	_, err := repo.GetRoomByID(ctx, unknownID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("room: expected sql.ErrNoRows, got %v", err)
+	}
+	_, err = repo.GetReservationByID(ctx, unknownID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("reservation: expected sql.ErrNoRows, got %v", err)
+	}
+	_, err = repo.GetUserByID(ctx, unknownID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("user: expected sql.ErrNoRows, got %v", err)
+	}
+
+	_, err = repo.InsertReservation(ctx, models.Reservation{StartDate: contractDay(40), EndDate: contractDay(41), RoomID: unknownID})
+	if err == nil {
+		t.Error("reservation of an unknown room inserted")
+	}
+}
+
+// insertContractUser adds an active user with password and a unique email address
+func insertContractUser(t *testing.T, repo repository.DatabaseRepo, password string) models.User {
+	t.Helper()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.User{
+		FirstName:   "Contract",
+		LastName:    "User",
+		Email:       fmt.Sprintf("user-%d%s", time.Now().UnixNano(), contractEmailDomain),
+		Password:    string(hashedPassword),
+		AccessLevel: models.AccessLevelStaff,
+	}
+	user.ID, err = repo.InsertUser(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func testContractAuthenticate(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	user := insertContractUser(t, repo, "correct horse 1")
+
+	id, hash, err := repo.Authenticate(ctx, user.Email, "correct horse 1")
+	if err != nil || id != user.ID || hash != user.Password {
+		t.Errorf("expected user %d to log in, got %d: %v", user.ID, id, err)
+	}
+
+	// email addresses are matched ignoring case
+	id, _, err = repo.Authenticate(ctx, strings.ToUpper(user.Email), "correct horse 1")
+	if err != nil || id != user.ID {
+		t.Errorf("upper case email: expected user %d, got %d: %v", user.ID, id, err)
+	}
+
+	_, _, err = repo.Authenticate(ctx, user.Email, "wrong horse 1")
+	if !errors.Is(err, repository.ErrIncorrectPassword) {
+		t.Errorf("wrong password: expected ErrIncorrectPassword, got %v", err)
+	}
+
+	_, _, err = repo.Authenticate(ctx, "nobody"+contractEmailDomain, "correct horse 1")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown email: expected sql.ErrNoRows, got %v", err)
+	}
+
+	err = repo.SetUserActive(ctx, user.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = repo.Authenticate(ctx, user.Email, "correct horse 1")
+	if !errors.Is(err, repository.ErrAccountDeactivated) {
+		t.Errorf("deactivated: expected ErrAccountDeactivated, got %v", err)
+	}
+	// a wrong password is reported before the account's state, which only its owner may learn
+	_, _, err = repo.Authenticate(ctx, user.Email, "wrong horse 1")
+	if !errors.Is(err, repository.ErrIncorrectPassword) {
+		t.Errorf("deactivated, wrong password: expected ErrIncorrectPassword, got %v", err)
+	}
+}
+
+func testContractUsers(t *testing.T, repo repository.DatabaseRepo) {
+	ctx := context.Background()
+	user := insertContractUser(t, repo, "correct horse 1")
+
+	stored, err := repo.GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ID != user.ID || !stored.Active || stored.AccessLevel != models.AccessLevelStaff {
+		t.Errorf("user not stored as inserted: %+v", stored)
+	}
+
+	_, err = repo.InsertUser(ctx, user)
+	if err == nil {
+		t.Error("second user with the same email inserted")
+	}
+
+	// emails are unique ignoring case
+	differentCase := user
+	differentCase.Email = strings.ToUpper(user.Email)
+	_, err = repo.InsertUser(ctx, differentCase)
+	if err == nil {
+		t.Error("second user with the same email in other case inserted")
+	}
+
+	user.LastName = "Renamed"
+	user.AccessLevel = models.AccessLevelManager
+	err = repo.UpdateUser(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := repo.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.LastName != "Renamed" || updated.AccessLevel != models.AccessLevelManager {
+		t.Errorf("user not updated: %+v", updated)
+	}
+
+	// changing the password ends the user's other sessions
+	version, err := repo.UpdatePassword(ctx, user.ID, user.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != updated.SessionVersion+1 {
+		t.Errorf("expected session version %d, got %d", updated.SessionVersion+1, version)
+	}
+
+	err = repo.SetUserActive(ctx, user.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deactivated, err := repo.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deactivated.Active || deactivated.SessionVersion != version+1 {
+		t.Errorf("deactivating should end all sessions: %+v", deactivated)
+	}
+}
+
+// dashboardStatsTests is the data for the dashboard stats contract, with room 1 booked from day 30 to 33
+// and room 2 from day 31 to 33
+var dashboardStatsTests = []struct {
+	name       string
+	day        int
+	arrivals   int
+	departures int
+	occupied   int
+}{
+	{"before", 29, 0, 0, 0},
+	{"first arrival", 30, 1, 0, 1},
+	{"second arrival", 31, 1, 0, 2},
+	{"both staying", 32, 0, 0, 2},
+	{"departures", 33, 0, 2, 0},
+}
+
+func testContractDashboardStats(t *testing.T, repo repository.DatabaseRepo) {
+	book(t, repo, 1, contractDay(30), contractDay(33))
+	book(t, repo, 2, contractDay(31), contractDay(33))
+
+	for _, e := range dashboardStatsTests {
+		stats, err := repo.DashboardStats(context.Background(), contractDay(e.day))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.ArrivalsToday != e.arrivals || stats.DeparturesToday != e.departures || stats.OccupiedRooms != e.occupied {
+			t.Errorf("%s: expected %d arrivals, %d departures and %d occupied rooms, got %+v",
+				e.name, e.arrivals, e.departures, e.occupied, stats)
+		}
+		// the totals count the whole database, which may hold more than the contract's data
+		if stats.TotalRooms < 2 || stats.Unprocessed < 2 {
+			t.Errorf("%s: expected at least 2 rooms and 2 unprocessed reservations, got %+v", e.name, stats)
+		}
+	}
+}
+
+// roomOccupancyTests is the data for the room occupancy contract, with room 1 booked from day 40 to 43
+// and again, overlapping, from day 41 to 45
+var roomOccupancyTests = []struct {
+	name   string
+	start  int
+	end    int
+	nights int
+	booked int
+}{
+	{"whole stay", 38, 48, 10, 5},
+	{"overlap only", 41, 43, 2, 2},
+	{"cut at the start", 42, 50, 8, 3},
+	{"cut at the end", 30, 41, 11, 1},
+	{"nothing booked", 50, 60, 10, 0},
+}
+
+func testContractRoomOccupancy(t *testing.T, repo repository.DatabaseRepo) {
+	book(t, repo, 1, contractDay(40), contractDay(43))
+	book(t, repo, 1, contractDay(41), contractDay(45))
+
+	for _, e := range roomOccupancyTests {
+		occupancy, err := repo.RoomOccupancy(context.Background(), contractDay(e.start), contractDay(e.end))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		booked := map[int]int{}
+		for _, row := range occupancy {
+			if row.Nights != e.nights {
+				t.Errorf("%s: expected %d nights for room %d, got %d", e.name, e.nights, row.Room.ID, row.Nights)
+			}
+			booked[row.Room.ID] = row.BookedNights
+		}
+		if booked[1] != e.booked || booked[2] != 0 {
+			t.Errorf("%s: expected %d booked nights for room 1 and none for room 2, got %v", e.name, e.booked, booked)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
 	"github.com/Sunpacker/go-booking-app/internal/config"
 	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"time"
 )
 
+// DefaultQueryTimeout bounds queries when the app config sets no QueryTimeout
+const DefaultQueryTimeout = 3 * time.Second
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
@@ -18,6 +23,16 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 	}
 }
 
+// queryContext derives the context of a single query from ctx, so that it is cancelled with the
+// request, and limits it to the configured timeout
+func (m *postgresDBRepo) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := DefaultQueryTimeout
+	if m.App != nil && m.App.QueryTimeout > 0 {
+		timeout = m.App.QueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 type testDBRepo struct {
 	App *config.AppConfig
 }
@@ -0,0 +1,36 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"testing"
+	"time"
+)
+
+func TestPostgresDBRepo_queryContext(t *testing.T) {
+	repo := &postgresDBRepo{App: &config.AppConfig{}}
+
+	ctx, cancel := repo.queryContext(context.Background())
+	deadline, ok := ctx.Deadline()
+	cancel()
+	if !ok || time.Until(deadline) > DefaultQueryTimeout {
+		t.Errorf("expected the default timeout, got deadline %v", deadline)
+	}
+
+	repo.App.QueryTimeout = 50 * time.Millisecond
+	ctx, cancel = repo.queryContext(context.Background())
+	deadline, _ = ctx.Deadline()
+	cancel()
+	if time.Until(deadline) > repo.App.QueryTimeout {
+		t.Errorf("configured timeout not used, deadline %v", deadline)
+	}
+
+	// a query ends with the request that started it
+	request, cancelRequest := context.WithCancel(context.Background())
+	ctx, cancel = repo.queryContext(request)
+	defer cancel()
+	cancelRequest()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("query not cancelled with the request: %v", ctx.Err())
+	}
+}
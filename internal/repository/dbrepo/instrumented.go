@@ -0,0 +1,363 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Sunpacker/go-booking-app/internal/metrics"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"github.com/Sunpacker/go-booking-app/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+// instrumentedDBRepo times and traces every call to the repository it wraps
+type instrumentedDBRepo struct {
+	DB      repository.DatabaseRepo
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedRepo wraps db so that each method call is recorded in m and traced in a span
+func NewInstrumentedRepo(db repository.DatabaseRepo, m *metrics.Metrics) repository.DatabaseRepo {
+	return &instrumentedDBRepo{
+		DB:      db,
+		metrics: m,
+	}
+}
+
+// observe starts timing method and tracing it in a child span of the one in ctx. The returned function
+// ends both, recording the error the method returned through err, which is nil for methods that cannot fail.
+func (m *instrumentedDBRepo) observe(ctx context.Context, method string) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "DatabaseRepo."+method, attribute.String("repository.method", method))
+
+	return ctx, func(err *error) {
+		m.metrics.ObserveQuery(method, start)
+
+		var failure error
+		// a missing row is an answer, not a failure of the query
+		if err != nil && !errors.Is(*err, sql.ErrNoRows) {
+			failure = *err
+		}
+		tracing.End(span, failure)
+	}
+}
+
+func (m *instrumentedDBRepo) AllUsers(ctx context.Context) bool {
+	ctx, done := m.observe(ctx, "AllUsers")
+	defer done(nil)
+	return m.DB.AllUsers(ctx)
+}
+
+func (m *instrumentedDBRepo) InsertReservation(ctx context.Context, dto models.Reservation) (_ int, err error) {
+	ctx, done := m.observe(ctx, "InsertReservation")
+	defer done(&err)
+	return m.DB.InsertReservation(ctx, dto)
+}
+
+func (m *instrumentedDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) (err error) {
+	ctx, done := m.observe(ctx, "InsertRoomRestriction")
+	defer done(&err)
+	return m.DB.InsertRoomRestriction(ctx, r)
+}
+
+func (m *instrumentedDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (_ bool, err error) {
+	ctx, done := m.observe(ctx, "SearchAvailabilityByDatesByRoomID")
+	defer done(&err)
+	return m.DB.SearchAvailabilityByDatesByRoomID(ctx, start, end, roomID)
+}
+
+func (m *instrumentedDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) (_ []models.Room, err error) {
+	ctx, done := m.observe(ctx, "SearchAvailabilityForAllRooms")
+	defer done(&err)
+	return m.DB.SearchAvailabilityForAllRooms(ctx, start, end)
+}
+
+func (m *instrumentedDBRepo) GetRoomByID(ctx context.Context, id int) (_ models.Room, err error) {
+	ctx, done := m.observe(ctx, "GetRoomByID")
+	defer done(&err)
+	return m.DB.GetRoomByID(ctx, id)
+}
+
+func (m *instrumentedDBRepo) AllRooms(ctx context.Context) (_ []models.Room, err error) {
+	ctx, done := m.observe(ctx, "AllRooms")
+	defer done(&err)
+	return m.DB.AllRooms(ctx)
+}
+
+func (m *instrumentedDBRepo) GetUserByID(ctx context.Context, id int) (_ models.User, err error) {
+	ctx, done := m.observe(ctx, "GetUserByID")
+	defer done(&err)
+	return m.DB.GetUserByID(ctx, id)
+}
+
+func (m *instrumentedDBRepo) GetUserByEmail(ctx context.Context, email string) (_ models.User, err error) {
+	ctx, done := m.observe(ctx, "GetUserByEmail")
+	defer done(&err)
+	return m.DB.GetUserByEmail(ctx, email)
+}
+
+func (m *instrumentedDBRepo) ListUsers(ctx context.Context) (_ []models.User, err error) {
+	ctx, done := m.observe(ctx, "ListUsers")
+	defer done(&err)
+	return m.DB.ListUsers(ctx)
+}
+
+func (m *instrumentedDBRepo) InsertUser(ctx context.Context, user models.User) (_ int, err error) {
+	ctx, done := m.observe(ctx, "InsertUser")
+	defer done(&err)
+	return m.DB.InsertUser(ctx, user)
+}
+
+func (m *instrumentedDBRepo) UpdateUser(ctx context.Context, user models.User) (err error) {
+	ctx, done := m.observe(ctx, "UpdateUser")
+	defer done(&err)
+	return m.DB.UpdateUser(ctx, user)
+}
+
+func (m *instrumentedDBRepo) SetUserActive(ctx context.Context, id int, active bool) (err error) {
+	ctx, done := m.observe(ctx, "SetUserActive")
+	defer done(&err)
+	return m.DB.SetUserActive(ctx, id, active)
+}
+
+func (m *instrumentedDBRepo) UpdatePassword(ctx context.Context, id int, hashedPassword string) (_ int, err error) {
+	ctx, done := m.observe(ctx, "UpdatePassword")
+	defer done(&err)
+	return m.DB.UpdatePassword(ctx, id, hashedPassword)
+}
+
+func (m *instrumentedDBRepo) Authenticate(ctx context.Context, email, testPassword string) (_ int, _ string, err error) {
+	ctx, done := m.observe(ctx, "Authenticate")
+	defer done(&err)
+	return m.DB.Authenticate(ctx, email, testPassword)
+}
+
+func (m *instrumentedDBRepo) InsertPasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) (err error) {
+	ctx, done := m.observe(ctx, "InsertPasswordResetToken")
+	defer done(&err)
+	return m.DB.InsertPasswordResetToken(ctx, userID, tokenHash, expiresAt)
+}
+
+func (m *instrumentedDBRepo) PasswordResetTokenUserID(ctx context.Context, tokenHash string) (_ int, err error) {
+	ctx, done := m.observe(ctx, "PasswordResetTokenUserID")
+	defer done(&err)
+	return m.DB.PasswordResetTokenUserID(ctx, tokenHash)
+}
+
+func (m *instrumentedDBRepo) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (_ int, err error) {
+	ctx, done := m.observe(ctx, "ResetPassword")
+	defer done(&err)
+	return m.DB.ResetPassword(ctx, tokenHash, hashedPassword)
+}
+
+func (m *instrumentedDBRepo) RecordFailedLogin(ctx context.Context, userID int, lockedUntil time.Time) (err error) {
+	ctx, done := m.observe(ctx, "RecordFailedLogin")
+	defer done(&err)
+	return m.DB.RecordFailedLogin(ctx, userID, lockedUntil)
+}
+
+func (m *instrumentedDBRepo) ResetFailedLogins(ctx context.Context, userID int) (err error) {
+	ctx, done := m.observe(ctx, "ResetFailedLogins")
+	defer done(&err)
+	return m.DB.ResetFailedLogins(ctx, userID)
+}
+
+func (m *instrumentedDBRepo) LockedUsers(ctx context.Context) (_ []models.User, err error) {
+	ctx, done := m.observe(ctx, "LockedUsers")
+	defer done(&err)
+	return m.DB.LockedUsers(ctx)
+}
+
+func (m *instrumentedDBRepo) InsertLoginEvent(ctx context.Context, event models.LoginEvent) (err error) {
+	ctx, done := m.observe(ctx, "InsertLoginEvent")
+	defer done(&err)
+	return m.DB.InsertLoginEvent(ctx, event)
+}
+
+func (m *instrumentedDBRepo) FailedLoginsByIP(ctx context.Context, ip string, since time.Time) (_ int, _ time.Time, err error) {
+	ctx, done := m.observe(ctx, "FailedLoginsByIP")
+	defer done(&err)
+	return m.DB.FailedLoginsByIP(ctx, ip, since)
+}
+
+func (m *instrumentedDBRepo) RecentLoginEvents(ctx context.Context, limit int) (_ []models.LoginEvent, err error) {
+	ctx, done := m.observe(ctx, "RecentLoginEvents")
+	defer done(&err)
+	return m.DB.RecentLoginEvents(ctx, limit)
+}
+
+func (m *instrumentedDBRepo) SetTOTPSecret(ctx context.Context, userID int, secret string) (err error) {
+	ctx, done := m.observe(ctx, "SetTOTPSecret")
+	defer done(&err)
+	return m.DB.SetTOTPSecret(ctx, userID, secret)
+}
+
+func (m *instrumentedDBRepo) EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) (err error) {
+	ctx, done := m.observe(ctx, "EnableTOTP")
+	defer done(&err)
+	return m.DB.EnableTOTP(ctx, userID, step, recoveryCodeHashes)
+}
+
+func (m *instrumentedDBRepo) DisableTOTP(ctx context.Context, userID int) (err error) {
+	ctx, done := m.observe(ctx, "DisableTOTP")
+	defer done(&err)
+	return m.DB.DisableTOTP(ctx, userID)
+}
+
+func (m *instrumentedDBRepo) UpdateTOTPLastStep(ctx context.Context, userID int, step int64) (err error) {
+	ctx, done := m.observe(ctx, "UpdateTOTPLastStep")
+	defer done(&err)
+	return m.DB.UpdateTOTPLastStep(ctx, userID, step)
+}
+
+func (m *instrumentedDBRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (err error) {
+	ctx, done := m.observe(ctx, "UseRecoveryCode")
+	defer done(&err)
+	return m.DB.UseRecoveryCode(ctx, userID, codeHash)
+}
+
+func (m *instrumentedDBRepo) AllReservations(ctx context.Context) (_ []models.Reservation, err error) {
+	ctx, done := m.observe(ctx, "AllReservations")
+	defer done(&err)
+	return m.DB.AllReservations(ctx)
+}
+
+func (m *instrumentedDBRepo) AllNewReservations(ctx context.Context) (_ []models.Reservation, err error) {
+	ctx, done := m.observe(ctx, "AllNewReservations")
+	defer done(&err)
+	return m.DB.AllNewReservations(ctx)
+}
+
+func (m *instrumentedDBRepo) ListReservations(ctx context.Context, query models.ReservationQuery) (_ []models.Reservation, _ int, err error) {
+	ctx, done := m.observe(ctx, "ListReservations")
+	defer done(&err)
+	return m.DB.ListReservations(ctx, query)
+}
+
+func (m *instrumentedDBRepo) SearchReservations(ctx context.Context, term string, limit int) (_ []models.Reservation, err error) {
+	ctx, done := m.observe(ctx, "SearchReservations")
+	defer done(&err)
+	return m.DB.SearchReservations(ctx, term, limit)
+}
+
+func (m *instrumentedDBRepo) EachReservation(ctx context.Context, filter models.ReservationFilter, fn func(models.Reservation) error) error {
+	ctx, done := m.observe(ctx, "EachReservation")
+	defer done(nil)
+	return m.DB.EachReservation(ctx, filter, fn)
+}
+
+func (m *instrumentedDBRepo) GetReservationByID(ctx context.Context, id int) (_ models.Reservation, err error) {
+	ctx, done := m.observe(ctx, "GetReservationByID")
+	defer done(&err)
+	return m.DB.GetReservationByID(ctx, id)
+}
+
+func (m *instrumentedDBRepo) UpdateReservation(ctx context.Context, reservation models.Reservation) (err error) {
+	ctx, done := m.observe(ctx, "UpdateReservation")
+	defer done(&err)
+	return m.DB.UpdateReservation(ctx, reservation)
+}
+
+func (m *instrumentedDBRepo) DeleteReservation(ctx context.Context, id int) (err error) {
+	ctx, done := m.observe(ctx, "DeleteReservation")
+	defer done(&err)
+	return m.DB.DeleteReservation(ctx, id)
+}
+
+func (m *instrumentedDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) (err error) {
+	ctx, done := m.observe(ctx, "UpdateProcessedForReservation")
+	defer done(&err)
+	return m.DB.UpdateProcessedForReservation(ctx, id, processed)
+}
+
+func (m *instrumentedDBRepo) DashboardStats(ctx context.Context, day time.Time) (_ models.DashboardStats, err error) {
+	ctx, done := m.observe(ctx, "DashboardStats")
+	defer done(&err)
+	return m.DB.DashboardStats(ctx, day)
+}
+
+func (m *instrumentedDBRepo) ReservationsArrivingOrDeparting(ctx context.Context, day time.Time) (_ []models.Reservation, err error) {
+	ctx, done := m.observe(ctx, "ReservationsArrivingOrDeparting")
+	defer done(&err)
+	return m.DB.ReservationsArrivingOrDeparting(ctx, day)
+}
+
+func (m *instrumentedDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) (_ []models.RoomOccupancy, err error) {
+	ctx, done := m.observe(ctx, "RoomOccupancy")
+	defer done(&err)
+	return m.DB.RoomOccupancy(ctx, start, end)
+}
+
+func (m *instrumentedDBRepo) MonthlyRevenue(ctx context.Context, start, end time.Time) (_ []models.MonthlyRevenue, err error) {
+	ctx, done := m.observe(ctx, "MonthlyRevenue")
+	defer done(&err)
+	return m.DB.MonthlyRevenue(ctx, start, end)
+}
+
+func (m *instrumentedDBRepo) AllICalFeeds(ctx context.Context) (_ []models.RoomICalFeed, err error) {
+	ctx, done := m.observe(ctx, "AllICalFeeds")
+	defer done(&err)
+	return m.DB.AllICalFeeds(ctx)
+}
+
+func (m *instrumentedDBRepo) GetICalFeedByID(ctx context.Context, id int) (_ models.RoomICalFeed, err error) {
+	ctx, done := m.observe(ctx, "GetICalFeedByID")
+	defer done(&err)
+	return m.DB.GetICalFeedByID(ctx, id)
+}
+
+func (m *instrumentedDBRepo) InsertICalFeed(ctx context.Context, feed models.RoomICalFeed) (_ int, err error) {
+	ctx, done := m.observe(ctx, "InsertICalFeed")
+	defer done(&err)
+	return m.DB.InsertICalFeed(ctx, feed)
+}
+
+func (m *instrumentedDBRepo) DeleteICalFeed(ctx context.Context, id int) (err error) {
+	ctx, done := m.observe(ctx, "DeleteICalFeed")
+	defer done(&err)
+	return m.DB.DeleteICalFeed(ctx, id)
+}
+
+func (m *instrumentedDBRepo) UpdateICalFeedSyncedAt(ctx context.Context, id int, syncedAt time.Time) (err error) {
+	ctx, done := m.observe(ctx, "UpdateICalFeedSyncedAt")
+	defer done(&err)
+	return m.DB.UpdateICalFeedSyncedAt(ctx, id, syncedAt)
+}
+
+func (m *instrumentedDBRepo) ExternalRestrictionsByFeedID(ctx context.Context, feedID int) (_ []models.RoomRestriction, err error) {
+	ctx, done := m.observe(ctx, "ExternalRestrictionsByFeedID")
+	defer done(&err)
+	return m.DB.ExternalRestrictionsByFeedID(ctx, feedID)
+}
+
+func (m *instrumentedDBRepo) InsertExternalRestriction(ctx context.Context, r models.RoomRestriction) (err error) {
+	ctx, done := m.observe(ctx, "InsertExternalRestriction")
+	defer done(&err)
+	return m.DB.InsertExternalRestriction(ctx, r)
+}
+
+func (m *instrumentedDBRepo) UpdateRoomRestrictionDates(ctx context.Context, id int, start, end time.Time) (err error) {
+	ctx, done := m.observe(ctx, "UpdateRoomRestrictionDates")
+	defer done(&err)
+	return m.DB.UpdateRoomRestrictionDates(ctx, id, start, end)
+}
+
+func (m *instrumentedDBRepo) DeleteRoomRestriction(ctx context.Context, id int) (err error) {
+	ctx, done := m.observe(ctx, "DeleteRoomRestriction")
+	defer done(&err)
+	return m.DB.DeleteRoomRestriction(ctx, id)
+}
+
+func (m *instrumentedDBRepo) InsertICalSyncLog(ctx context.Context, log models.ICalSyncLog) (err error) {
+	ctx, done := m.observe(ctx, "InsertICalSyncLog")
+	defer done(&err)
+	return m.DB.InsertICalSyncLog(ctx, log)
+}
+
+func (m *instrumentedDBRepo) ICalSyncLogsByFeedID(ctx context.Context, feedID, limit int) (_ []models.ICalSyncLog, err error) {
+	ctx, done := m.observe(ctx, "ICalSyncLogsByFeedID")
+	defer done(&err)
+	return m.DB.ICalSyncLogsByFeedID(ctx, feedID, limit)
+}
@@ -0,0 +1,51 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/metrics"
+	"github.com/Sunpacker/go-booking-app/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestInstrumentedRepo(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer func() {
+		_ = provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	}()
+
+	repo := NewInstrumentedRepo(NewTestRepo(&config.AppConfig{}), metrics.New())
+
+	ctx, request := tracing.Start(context.Background(), "GET /make-reservation")
+	_, err := repo.GetRoomByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the test repository fails for rooms above 2
+	_, err = repo.GetRoomByID(ctx, 3)
+	if err == nil {
+		t.Fatal("error of the wrapped repository lost")
+	}
+	request.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected a span per call and one for the request, got %d", len(spans))
+	}
+	for i, expected := range []codes.Code{codes.Unset, codes.Error} {
+		if spans[i].Name != "DatabaseRepo.GetRoomByID" || spans[i].Status.Code != expected {
+			t.Errorf("span %d: got %s with status %v", i, spans[i].Name, spans[i].Status)
+		}
+		if spans[i].Parent.SpanID() != request.SpanContext().SpanID() {
+			t.Errorf("span %d is not a child of the request", i)
+		}
+	}
+}
@@ -0,0 +1,1231 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryData is what a memory repository starts out with. IDs of zero are assigned in order.
+type MemoryData struct {
+	Rooms []models.Room
+	// Users need a hashed Password to be able to log in
+	Users []models.User
+}
+
+// passwordResetToken is a row of password_reset_tokens
+type passwordResetToken struct {
+	UserID    int
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// memoryDBRepo keeps all data in maps guarded by a mutex, following the rules of the Postgres
+// schema: foreign keys are checked and cascade on delete, unique columns stay unique and missing
+// rows are reported as sql.ErrNoRows. Nothing survives a restart.
+type memoryDBRepo struct {
+	App *config.AppConfig
+
+	mu            sync.RWMutex
+	sequences     map[string]int
+	rooms         map[int]models.Room
+	reservations  map[int]models.Reservation
+	restrictions  map[int]models.RoomRestriction
+	users         map[int]models.User
+	resetTokens   map[string]passwordResetToken
+	recoveryCodes map[int]map[string]bool
+	loginEvents   map[int]models.LoginEvent
+	feeds         map[int]models.RoomICalFeed
+	syncLogs      map[int]models.ICalSyncLog
+}
+
+// NewMemoryRepo returns a repository that keeps everything in memory, for demo mode and tests
+func NewMemoryRepo(a *config.AppConfig, data MemoryData) repository.DatabaseRepo {
+	m := &memoryDBRepo{
+		App:           a,
+		sequences:     make(map[string]int),
+		rooms:         make(map[int]models.Room),
+		reservations:  make(map[int]models.Reservation),
+		restrictions:  make(map[int]models.RoomRestriction),
+		users:         make(map[int]models.User),
+		resetTokens:   make(map[string]passwordResetToken),
+		recoveryCodes: make(map[int]map[string]bool),
+		loginEvents:   make(map[int]models.LoginEvent),
+		feeds:         make(map[int]models.RoomICalFeed),
+		syncLogs:      make(map[int]models.ICalSyncLog),
+	}
+
+	now := time.Now()
+	for _, room := range data.Rooms {
+		room.ID = m.assignID("rooms", room.ID)
+		room.CreatedAt, room.UpdatedAt = now, now
+		m.rooms[room.ID] = room
+	}
+	for _, user := range data.Users {
+		user.ID = m.assignID("users", user.ID)
+		user.CreatedAt, user.UpdatedAt = now, now
+		m.users[user.ID] = user
+	}
+
+	return m
+}
+
+// assignID returns id, or the next ID of table if it is zero, like a serial column
+func (m *memoryDBRepo) assignID(table string, id int) int {
+	if id == 0 {
+		id = m.sequences[table] + 1
+	}
+	if id > m.sequences[table] {
+		m.sequences[table] = id
+	}
+	return id
+}
+
+// dateOf drops the time of day, as date columns do
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// nightsBetween counts the nights from start to end
+func nightsBetween(start, end time.Time) int {
+	return int(dateOf(end).Sub(dateOf(start)).Hours() / 24)
+}
+
+// overlaps reports whether a stay from start to end shares a night with restriction
+func overlaps(restriction models.RoomRestriction, start, end time.Time) bool {
+	return start.Before(restriction.EndDate) && end.After(restriction.StartDate)
+}
+
+// withRoom fills in the joined room of reservation, which is left empty if the room is gone
+func (m *memoryDBRepo) withRoom(reservation models.Reservation) models.Reservation {
+	reservation.Room = models.Room{}
+	if room, ok := m.rooms[reservation.RoomID]; ok {
+		reservation.Room = models.Room{ID: room.ID, RoomName: room.RoomName}
+	}
+	return reservation
+}
+
+func (m *memoryDBRepo) userByEmail(email string) (models.User, bool) {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
+
+// emailInUse mirrors the unique index on lower(users.email)
+func (m *memoryDBRepo) emailInUse(email string, exceptID int) bool {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) && user.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryDBRepo) AllUsers(ctx context.Context) bool {
+	return true
+}
+
+func (m *memoryDBRepo) InsertReservation(ctx context.Context, dto models.Reservation) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[dto.RoomID]; !ok {
+		return 0, fmt.Errorf("room %d does not exist", dto.RoomID)
+	}
+	if dto.ConfirmationCode != "" {
+		for _, reservation := range m.reservations {
+			if reservation.ConfirmationCode == dto.ConfirmationCode {
+				return 0, errors.New("confirmation code is already in use")
+			}
+		}
+	}
+
+	now := time.Now()
+	reservation := models.Reservation{
+		ID:               m.assignID("reservations", 0),
+		FirstName:        dto.FirstName,
+		LastName:         dto.LastName,
+		Email:            dto.Email,
+		Phone:            dto.Phone,
+		StartDate:        dto.StartDate,
+		EndDate:          dto.EndDate,
+		RoomID:           dto.RoomID,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		ConfirmationCode: dto.ConfirmationCode,
+	}
+	m.reservations[reservation.ID] = reservation
+
+	return reservation.ID, nil
+}
+
+func (m *memoryDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[r.RoomID]; !ok {
+		return fmt.Errorf("room %d does not exist", r.RoomID)
+	}
+	if _, ok := m.reservations[r.ReservationID]; !ok && r.ReservationID != 0 {
+		return fmt.Errorf("reservation %d does not exist", r.ReservationID)
+	}
+
+	now := time.Now()
+	m.restrictions[m.assignID("room_restrictions", 0)] = models.RoomRestriction{
+		ID:            m.sequences["room_restrictions"],
+		StartDate:     r.StartDate,
+		EndDate:       r.EndDate,
+		RoomID:        r.RoomID,
+		ReservationID: r.ReservationID,
+		RestrictionID: r.RestrictionID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, restriction := range m.restrictions {
+		if restriction.RoomID == roomID && overlaps(restriction, start, end) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (m *memoryDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	blocked := make(map[int]bool)
+	for _, restriction := range m.restrictions {
+		if overlaps(restriction, start, end) {
+			blocked[restriction.RoomID] = true
+		}
+	}
+
+	var rooms []models.Room
+	for _, room := range m.rooms {
+		if !blocked[room.ID] {
+			rooms = append(rooms, models.Room{ID: room.ID, RoomName: room.RoomName})
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+
+	return rooms, nil
+}
+
+func (m *memoryDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return room, sql.ErrNoRows
+	}
+	return room, nil
+}
+
+func (m *memoryDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []models.Room
+	for _, room := range m.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].RoomName < rooms[j].RoomName })
+
+	return rooms, nil
+}
+
+func (m *memoryDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *memoryDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.userByEmail(email)
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *memoryDBRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []models.User
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		if a.Active != b.Active {
+			return a.Active
+		}
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		return a.FirstName < b.FirstName
+	})
+
+	return users, nil
+}
+
+// InsertUser adds an active user; user.Password must already be hashed
+func (m *memoryDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailInUse(user.Email, 0) {
+		return 0, fmt.Errorf("email %s is already in use", user.Email)
+	}
+
+	now := time.Now()
+	inserted := models.User{
+		ID:          m.assignID("users", 0),
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		Email:       user.Email,
+		Password:    user.Password,
+		AccessLevel: user.AccessLevel,
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.users[inserted.ID] = inserted
+
+	return inserted.ID, nil
+}
+
+func (m *memoryDBRepo) UpdateUser(ctx context.Context, user models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[user.ID]
+	if !ok {
+		return nil
+	}
+	if m.emailInUse(user.Email, user.ID) {
+		return fmt.Errorf("email %s is already in use", user.Email)
+	}
+
+	stored.FirstName = user.FirstName
+	stored.LastName = user.LastName
+	stored.Email = user.Email
+	stored.AccessLevel = user.AccessLevel
+	stored.UpdatedAt = time.Now()
+	m.users[user.ID] = stored
+
+	return nil
+}
+
+// SetUserActive activates or deactivates a user. Deactivating also ends all sessions of the user.
+func (m *memoryDBRepo) SetUserActive(ctx context.Context, id int, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+
+	user.Active = active
+	if !active {
+		user.SessionVersion++
+	}
+	user.UpdatedAt = time.Now()
+	m.users[id] = user
+
+	return nil
+}
+
+// UpdatePassword sets a new password hash and ends the user's other sessions,
+// returning the session version that remains valid
+func (m *memoryDBRepo) UpdatePassword(ctx context.Context, id int, hashedPassword string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	user.Password = hashedPassword
+	user.SessionVersion++
+	user.UpdatedAt = time.Now()
+	m.users[id] = user
+
+	return user.SessionVersion, nil
+}
+
+func (m *memoryDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	m.mu.RLock()
+	user, ok := m.userByEmail(email)
+	m.mu.RUnlock()
+
+	if !ok {
+		return 0, "", sql.ErrNoRows
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", repository.ErrIncorrectPassword
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	if !user.Active {
+		return 0, "", repository.ErrAccountDeactivated
+	}
+
+	return user.ID, user.Password, nil
+}
+
+func (m *memoryDBRepo) InsertPasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return fmt.Errorf("user %d does not exist", userID)
+	}
+	if _, ok := m.resetTokens[tokenHash]; ok {
+		return errors.New("reset token is already in use")
+	}
+
+	m.resetTokens[tokenHash] = passwordResetToken{UserID: userID, ExpiresAt: expiresAt}
+	return nil
+}
+
+// PasswordResetTokenUserID returns the user a reset token belongs to, if it is unused and not expired
+func (m *memoryDBRepo) PasswordResetTokenUserID(ctx context.Context, tokenHash string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.resetTokens[tokenHash]
+	if !ok || token.Used || !token.ExpiresAt.After(time.Now()) {
+		return 0, sql.ErrNoRows
+	}
+	return token.UserID, nil
+}
+
+// ResetPassword uses up a reset token, stores the new password hash and invalidates the user's
+// other reset tokens and sessions. It returns the id of the user whose password was changed.
+func (m *memoryDBRepo) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.resetTokens[tokenHash]
+	if !ok || token.Used || !token.ExpiresAt.After(time.Now()) {
+		return 0, repository.ErrInvalidResetToken
+	}
+
+	for hash, other := range m.resetTokens {
+		if other.UserID == token.UserID {
+			other.Used = true
+			m.resetTokens[hash] = other
+		}
+	}
+
+	user := m.users[token.UserID]
+	user.Password = hashedPassword
+	user.SessionVersion++
+	user.FailedLogins = 0
+	user.LastFailedLoginAt = time.Time{}
+	user.LockedUntil = time.Time{}
+	user.UpdatedAt = time.Now()
+	m.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+// RecordFailedLogin counts one more failed login for the user and locks the account
+// until lockedUntil, unless it is the zero time
+func (m *memoryDBRepo) RecordFailedLogin(ctx context.Context, userID int, lockedUntil time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil
+	}
+
+	user.FailedLogins++
+	user.LastFailedLoginAt = time.Now()
+	if !lockedUntil.IsZero() {
+		user.LockedUntil = lockedUntil
+	}
+	m.users[userID] = user
+
+	return nil
+}
+
+// ResetFailedLogins clears the failure count and any lock, after a successful login or an admin unlock
+func (m *memoryDBRepo) ResetFailedLogins(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil
+	}
+
+	user.FailedLogins = 0
+	user.LastFailedLoginAt = time.Time{}
+	user.LockedUntil = time.Time{}
+	m.users[userID] = user
+
+	return nil
+}
+
+func (m *memoryDBRepo) LockedUsers(ctx context.Context) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var users []models.User
+	for _, user := range m.users {
+		if user.IsLocked(now) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].LockedUntil.After(users[j].LockedUntil) })
+
+	return users, nil
+}
+
+func (m *memoryDBRepo) InsertLoginEvent(ctx context.Context, event models.LoginEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[event.UserID]; !ok && event.UserID != 0 {
+		return fmt.Errorf("user %d does not exist", event.UserID)
+	}
+
+	now := time.Now()
+	event.ID = m.assignID("login_events", 0)
+	event.CreatedAt, event.UpdatedAt = now, now
+	m.loginEvents[event.ID] = event
+
+	return nil
+}
+
+// FailedLoginsByIP returns how many failed logins came from ip since the given time, and when the last one was
+func (m *memoryDBRepo) FailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int
+	var last time.Time
+	for _, event := range m.loginEvents {
+		if event.IPAddress != ip || event.Success || !event.CreatedAt.After(since) {
+			continue
+		}
+		count++
+		if event.CreatedAt.After(last) {
+			last = event.CreatedAt
+		}
+	}
+
+	return count, last, nil
+}
+
+func (m *memoryDBRepo) RecentLoginEvents(ctx context.Context, limit int) ([]models.LoginEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var events []models.LoginEvent
+	for _, event := range m.loginEvents {
+		events = append(events, event)
+	}
+	// newest first; IDs order events logged within the same instant
+	sort.Slice(events, func(i, j int) bool { return events[i].ID > events[j].ID })
+
+	return limitSlice(events, limit), nil
+}
+
+// SetTOTPSecret stores the secret of a two-factor enrollment that has not been confirmed yet
+func (m *memoryDBRepo) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPEnabled = false
+	user.UpdatedAt = time.Now()
+	m.users[userID] = user
+
+	return nil
+}
+
+// EnableTOTP turns on two-factor login with the stored secret and replaces the user's recovery codes
+func (m *memoryDBRepo) EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok || user.TOTPSecret == "" {
+		return repository.ErrTOTPNotStarted
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.UpdatedAt = time.Now()
+	m.users[userID] = user
+
+	codes := make(map[string]bool, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = false
+	}
+	m.recoveryCodes[userID] = codes
+
+	return nil
+}
+
+func (m *memoryDBRepo) DisableTOTP(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	user.UpdatedAt = time.Now()
+	m.users[userID] = user
+	delete(m.recoveryCodes, userID)
+
+	return nil
+}
+
+// UpdateTOTPLastStep records the time step of a used code. It fails if that step, or a later one,
+// was already used, so the same code cannot log in twice even with concurrent requests.
+func (m *memoryDBRepo) UpdateTOTPLastStep(ctx context.Context, userID int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok || user.TOTPLastStep >= step {
+		return repository.ErrCodeAlreadyUsed
+	}
+
+	user.TOTPLastStep = step
+	m.users[userID] = user
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used, failing if there is none
+func (m *memoryDBRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, ok := m.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return repository.ErrInvalidRecoveryCode
+	}
+
+	m.recoveryCodes[userID][codeHash] = true
+	return nil
+}
+
+// matchesFilter applies the conditions of reservationFilterClause to reservation
+func matchesFilter(reservation models.Reservation, filter models.ReservationFilter) bool {
+	if !filter.StartDate.IsZero() && reservation.EndDate.Before(filter.StartDate) {
+		return false
+	}
+	if !filter.EndDate.IsZero() && reservation.StartDate.After(filter.EndDate) {
+		return false
+	}
+	if filter.RoomID > 0 && reservation.RoomID != filter.RoomID {
+		return false
+	}
+
+	if filter.Search != "" {
+		search := strings.ToLower(filter.Search)
+		if !strings.Contains(strings.ToLower(reservation.FirstName), search) &&
+			!strings.Contains(strings.ToLower(reservation.LastName), search) &&
+			!strings.Contains(strings.ToLower(reservation.Email), search) {
+			return false
+		}
+	}
+
+	switch filter.Status {
+	case models.ReservationStatusNew:
+		return reservation.Processed == 0
+	case models.ReservationStatusProcessed:
+		return reservation.Processed == 1
+	}
+	return true
+}
+
+// filterReservations returns the reservations keep accepts, with their rooms, by start date
+func (m *memoryDBRepo) filterReservations(keep func(models.Reservation) bool) []models.Reservation {
+	var reservations []models.Reservation
+	for _, reservation := range m.reservations {
+		if keep(reservation) {
+			reservations = append(reservations, m.withRoom(reservation))
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		a, b := reservations[i], reservations[j]
+		if !a.StartDate.Equal(b.StartDate) {
+			return a.StartDate.Before(b.StartDate)
+		}
+		return a.ID < b.ID
+	})
+	return reservations
+}
+
+func limitSlice[T any](rows []T, limit int) []T {
+	if limit < len(rows) {
+		return rows[:limit]
+	}
+	return rows
+}
+
+func (m *memoryDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterReservations(func(models.Reservation) bool { return true }), nil
+}
+
+func (m *memoryDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterReservations(func(reservation models.Reservation) bool {
+		return reservation.Processed == 0
+	}), nil
+}
+
+// reservationLess compares reservations by the sort keys of reservationSortColumns
+var reservationLess = map[string]func(a, b models.Reservation) bool{
+	"id":         func(a, b models.Reservation) bool { return a.ID < b.ID },
+	"last_name":  func(a, b models.Reservation) bool { return a.LastName < b.LastName },
+	"room":       func(a, b models.Reservation) bool { return a.Room.RoomName < b.Room.RoomName },
+	"start_date": func(a, b models.Reservation) bool { return a.StartDate.Before(b.StartDate) },
+	"end_date":   func(a, b models.Reservation) bool { return a.EndDate.Before(b.EndDate) },
+	"created_at": func(a, b models.Reservation) bool { return a.CreatedAt.Before(b.CreatedAt) },
+}
+
+// ListReservations returns one page of reservations matching query along with the total number of matches
+func (m *memoryDBRepo) ListReservations(ctx context.Context, query models.ReservationQuery) ([]models.Reservation, int, error) {
+	if query.Offset() < 0 || query.PageSize < 0 {
+		return nil, 0, errors.New("page and page size cannot be negative")
+	}
+
+	m.mu.RLock()
+	reservations := m.filterReservations(func(reservation models.Reservation) bool {
+		return matchesFilter(reservation, query.ReservationFilter)
+	})
+	m.mu.RUnlock()
+
+	less, ok := reservationLess[query.Sort]
+	if !ok {
+		less = reservationLess["start_date"]
+	}
+	descending := query.Direction == models.SortDesc
+
+	sort.SliceStable(reservations, func(i, j int) bool {
+		a, b := reservations[i], reservations[j]
+		if descending {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.ID < b.ID
+	})
+
+	total := len(reservations)
+	if query.Offset() >= total {
+		return nil, total, nil
+	}
+	return limitSlice(reservations[query.Offset():], query.PageSize), total, nil
+}
+
+// EachReservation streams reservations matching filter to fn one row at a time,
+// stopping at the first error returned by fn
+func (m *memoryDBRepo) EachReservation(ctx context.Context, filter models.ReservationFilter, fn func(models.Reservation) error) error {
+	// fn runs without the lock, so that it may use the repository itself
+	m.mu.RLock()
+	reservations := m.filterReservations(func(reservation models.Reservation) bool {
+		return matchesFilter(reservation, filter)
+	})
+	m.mu.RUnlock()
+
+	for _, reservation := range reservations {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		err = fn(reservation)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchReservations finds reservations by confirmation code, or by guest name, email or phone digits
+// containing term. Unlike Postgres there is no fuzzy matching: exact codes come first, then the latest stays.
+func (m *memoryDBRepo) SearchReservations(ctx context.Context, term string, limit int) ([]models.Reservation, error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return nil, nil
+	}
+
+	lowerTerm := strings.ToLower(term)
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, term)
+
+	m.mu.RLock()
+	reservations := m.filterReservations(func(reservation models.Reservation) bool {
+		name := strings.ToLower(reservation.FirstName + " " + reservation.LastName)
+		phoneDigits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, reservation.Phone)
+
+		return reservation.ConfirmationCode == strings.ToUpper(term) ||
+			strings.Contains(name, lowerTerm) ||
+			strings.Contains(strings.ToLower(reservation.Email), lowerTerm) ||
+			(len(digits) >= 3 && strings.Contains(phoneDigits, digits))
+	})
+	m.mu.RUnlock()
+
+	code := strings.ToUpper(term)
+	sort.SliceStable(reservations, func(i, j int) bool {
+		a, b := reservations[i], reservations[j]
+		if (a.ConfirmationCode == code) != (b.ConfirmationCode == code) {
+			return a.ConfirmationCode == code
+		}
+		return a.StartDate.After(b.StartDate)
+	})
+
+	return limitSlice(reservations, limit), nil
+}
+
+func (m *memoryDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reservation, ok := m.reservations[id]
+	if !ok {
+		return reservation, sql.ErrNoRows
+	}
+	return m.withRoom(reservation), nil
+}
+
+func (m *memoryDBRepo) UpdateReservation(ctx context.Context, reservation models.Reservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.reservations[reservation.ID]
+	if !ok {
+		return nil
+	}
+
+	stored.FirstName = reservation.FirstName
+	stored.LastName = reservation.LastName
+	stored.Email = reservation.Email
+	stored.Phone = reservation.Phone
+	stored.UpdatedAt = time.Now()
+	m.reservations[reservation.ID] = stored
+
+	return nil
+}
+
+func (m *memoryDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.reservations, id)
+	for restrictionID, restriction := range m.restrictions {
+		if restriction.ReservationID == id {
+			delete(m.restrictions, restrictionID)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reservation, ok := m.reservations[id]
+	if !ok {
+		return nil
+	}
+
+	reservation.Processed = processed
+	m.reservations[id] = reservation
+
+	return nil
+}
+
+// DashboardStats counts today's arrivals, departures, occupied rooms and unprocessed reservations
+func (m *memoryDBRepo) DashboardStats(ctx context.Context, day time.Time) (models.DashboardStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	day = dateOf(day)
+	stats := models.DashboardStats{TotalRooms: len(m.rooms)}
+
+	for _, reservation := range m.reservations {
+		if dateOf(reservation.StartDate).Equal(day) {
+			stats.ArrivalsToday++
+		}
+		if dateOf(reservation.EndDate).Equal(day) {
+			stats.DeparturesToday++
+		}
+		if reservation.Processed == 0 {
+			stats.Unprocessed++
+		}
+	}
+
+	occupied := make(map[int]bool)
+	for _, restriction := range m.restrictions {
+		if !dateOf(restriction.StartDate).After(day) && dateOf(restriction.EndDate).After(day) {
+			occupied[restriction.RoomID] = true
+		}
+	}
+	stats.OccupiedRooms = len(occupied)
+
+	return stats, nil
+}
+
+// ReservationsArrivingOrDeparting returns reservations starting or ending on day
+func (m *memoryDBRepo) ReservationsArrivingOrDeparting(ctx context.Context, day time.Time) ([]models.Reservation, error) {
+	m.mu.RLock()
+	reservations := m.filterReservations(func(reservation models.Reservation) bool {
+		return dateOf(reservation.StartDate).Equal(dateOf(day)) || dateOf(reservation.EndDate).Equal(dateOf(day))
+	})
+	m.mu.RUnlock()
+
+	sort.SliceStable(reservations, func(i, j int) bool {
+		a, b := reservations[i], reservations[j]
+		if a.Room.RoomName != b.Room.RoomName {
+			return a.Room.RoomName < b.Room.RoomName
+		}
+		return a.LastName < b.LastName
+	})
+
+	return reservations, nil
+}
+
+// RoomOccupancy returns, for every room, how many nights between start and end are blocked
+func (m *memoryDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	rooms, err := m.AllRooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nights := nightsBetween(start, end)
+	var occupancy []models.RoomOccupancy
+	for _, room := range rooms {
+		// a night blocked by overlapping restrictions (e.g. a reservation and an external block) counts once
+		booked := make(map[time.Time]bool)
+		for _, restriction := range m.restrictions {
+			if restriction.RoomID != room.ID || !overlaps(restriction, start, end) {
+				continue
+			}
+
+			from, to := dateOf(restriction.StartDate), dateOf(restriction.EndDate)
+			if from.Before(dateOf(start)) {
+				from = dateOf(start)
+			}
+			if to.After(dateOf(end)) {
+				to = dateOf(end)
+			}
+			for night := from; night.Before(to); night = night.AddDate(0, 0, 1) {
+				booked[night] = true
+			}
+		}
+
+		occupancy = append(occupancy, models.RoomOccupancy{
+			Room:         models.Room{ID: room.ID, RoomName: room.RoomName},
+			Nights:       nights,
+			BookedNights: len(booked),
+		})
+	}
+
+	return occupancy, nil
+}
+
+// MonthlyRevenue sums nights times room rate for reservations arriving between start and end, per month.
+// Months without reservations are included with zero revenue.
+func (m *memoryDBRepo) MonthlyRevenue(ctx context.Context, start, end time.Time) ([]models.MonthlyRevenue, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	firstMonth := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	endMonth := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var revenue []models.MonthlyRevenue
+	for month := firstMonth; month.Before(endMonth); month = month.AddDate(0, 1, 0) {
+		row := models.MonthlyRevenue{Month: month}
+
+		for _, reservation := range m.reservations {
+			arrival := reservation.StartDate
+			if arrival.Year() != month.Year() || arrival.Month() != month.Month() {
+				continue
+			}
+			row.Revenue += nightsBetween(reservation.StartDate, reservation.EndDate) * m.rooms[reservation.RoomID].NightlyRate
+		}
+
+		revenue = append(revenue, row)
+	}
+
+	return revenue, nil
+}
+
+// withFeedRoom fills in the joined room of feed
+func (m *memoryDBRepo) withFeedRoom(feed models.RoomICalFeed) models.RoomICalFeed {
+	feed.Room = models.Room{}
+	if room, ok := m.rooms[feed.RoomID]; ok {
+		feed.Room = models.Room{ID: room.ID, RoomName: room.RoomName}
+	}
+	return feed
+}
+
+func (m *memoryDBRepo) AllICalFeeds(ctx context.Context) ([]models.RoomICalFeed, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var feeds []models.RoomICalFeed
+	for _, feed := range m.feeds {
+		feeds = append(feeds, m.withFeedRoom(feed))
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		a, b := feeds[i], feeds[j]
+		if a.Room.RoomName != b.Room.RoomName {
+			return a.Room.RoomName < b.Room.RoomName
+		}
+		return a.ID < b.ID
+	})
+
+	return feeds, nil
+}
+
+func (m *memoryDBRepo) GetICalFeedByID(ctx context.Context, id int) (models.RoomICalFeed, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	feed, ok := m.feeds[id]
+	if !ok {
+		return feed, sql.ErrNoRows
+	}
+	return m.withFeedRoom(feed), nil
+}
+
+func (m *memoryDBRepo) InsertICalFeed(ctx context.Context, feed models.RoomICalFeed) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[feed.RoomID]; !ok {
+		return 0, fmt.Errorf("room %d does not exist", feed.RoomID)
+	}
+
+	now := time.Now()
+	inserted := models.RoomICalFeed{
+		ID:        m.assignID("room_ical_feeds", 0),
+		RoomID:    feed.RoomID,
+		URL:       feed.URL,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.feeds[inserted.ID] = inserted
+
+	return inserted.ID, nil
+}
+
+func (m *memoryDBRepo) DeleteICalFeed(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.feeds, id)
+	for restrictionID, restriction := range m.restrictions {
+		if restriction.FeedID == id {
+			delete(m.restrictions, restrictionID)
+		}
+	}
+	for logID, log := range m.syncLogs {
+		if log.FeedID == id {
+			delete(m.syncLogs, logID)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) UpdateICalFeedSyncedAt(ctx context.Context, id int, syncedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	feed, ok := m.feeds[id]
+	if !ok {
+		return nil
+	}
+
+	feed.LastSyncedAt = syncedAt
+	feed.UpdatedAt = time.Now()
+	m.feeds[id] = feed
+
+	return nil
+}
+
+func (m *memoryDBRepo) ExternalRestrictionsByFeedID(ctx context.Context, feedID int) ([]models.RoomRestriction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var restrictions []models.RoomRestriction
+	for _, restriction := range m.restrictions {
+		if restriction.FeedID == feedID && restriction.RestrictionID == models.RestrictionExternal {
+			restrictions = append(restrictions, restriction)
+		}
+	}
+	sort.Slice(restrictions, func(i, j int) bool { return restrictions[i].ID < restrictions[j].ID })
+
+	return restrictions, nil
+}
+
+func (m *memoryDBRepo) InsertExternalRestriction(ctx context.Context, r models.RoomRestriction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[r.RoomID]; !ok {
+		return fmt.Errorf("room %d does not exist", r.RoomID)
+	}
+	if _, ok := m.feeds[r.FeedID]; !ok {
+		return fmt.Errorf("feed %d does not exist", r.FeedID)
+	}
+	for _, restriction := range m.restrictions {
+		if restriction.FeedID == r.FeedID && restriction.ExternalUID == r.ExternalUID {
+			return fmt.Errorf("event %s of feed %d is already imported", r.ExternalUID, r.FeedID)
+		}
+	}
+
+	now := time.Now()
+	m.restrictions[m.assignID("room_restrictions", 0)] = models.RoomRestriction{
+		ID:            m.sequences["room_restrictions"],
+		StartDate:     r.StartDate,
+		EndDate:       r.EndDate,
+		RoomID:        r.RoomID,
+		RestrictionID: models.RestrictionExternal,
+		FeedID:        r.FeedID,
+		ExternalUID:   r.ExternalUID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	return nil
+}
+
+func (m *memoryDBRepo) UpdateRoomRestrictionDates(ctx context.Context, id int, start, end time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	restriction, ok := m.restrictions[id]
+	if !ok {
+		return nil
+	}
+
+	restriction.StartDate = start
+	restriction.EndDate = end
+	restriction.UpdatedAt = time.Now()
+	m.restrictions[id] = restriction
+
+	return nil
+}
+
+func (m *memoryDBRepo) DeleteRoomRestriction(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.restrictions, id)
+	return nil
+}
+
+func (m *memoryDBRepo) InsertICalSyncLog(ctx context.Context, log models.ICalSyncLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.feeds[log.FeedID]; !ok {
+		return fmt.Errorf("feed %d does not exist", log.FeedID)
+	}
+
+	now := time.Now()
+	log.ID = m.assignID("ical_sync_logs", 0)
+	log.CreatedAt, log.UpdatedAt = now, now
+	m.syncLogs[log.ID] = log
+
+	return nil
+}
+
+func (m *memoryDBRepo) ICalSyncLogsByFeedID(ctx context.Context, feedID, limit int) ([]models.ICalSyncLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var logs []models.ICalSyncLog
+	for _, log := range m.syncLogs {
+		if log.FeedID == feedID {
+			logs = append(logs, log)
+		}
+	}
+	// newest first; IDs order logs written within the same instant
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ID > logs[j].ID })
+
+	return limitSlice(logs, limit), nil
+}
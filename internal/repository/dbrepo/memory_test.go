@@ -0,0 +1,141 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Sunpacker/go-booking-app/internal/config"
+	"github.com/Sunpacker/go-booking-app/internal/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newMemoryTestRepo() *memoryDBRepo {
+	return NewMemoryRepo(&config.AppConfig{}, MemoryData{
+		Rooms: []models.Room{
+			{RoomName: "General's Quarters", NightlyRate: 9900},
+			{RoomName: "Major's Suite", NightlyRate: 14900},
+		},
+	}).(*memoryDBRepo)
+}
+
+func TestMemoryRepo_Concurrency(t *testing.T) {
+	repo := newMemoryTestRepo()
+	ctx := context.Background()
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	const bookings = 50
+	ids := make(chan int, bookings)
+	var wg sync.WaitGroup
+	for i := 0; i < bookings; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			arrival := start.AddDate(0, 0, 2*i)
+			id, err := repo.InsertReservation(ctx, models.Reservation{RoomID: 1, StartDate: arrival, EndDate: arrival.AddDate(0, 0, 1)})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+				RoomID: 1, ReservationID: id, RestrictionID: 1, StartDate: arrival, EndDate: arrival.AddDate(0, 0, 1),
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			_, _ = repo.SearchAvailabilityForAllRooms(ctx, arrival, arrival.AddDate(0, 0, 1))
+			_, _ = repo.AllReservations(ctx)
+			ids <- id
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("id %d handed out twice", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != bookings || len(repo.restrictions) != bookings {
+		t.Errorf("expected %d reservations and restrictions, got %d and %d", bookings, len(seen), len(repo.restrictions))
+	}
+}
+
+func TestMemoryRepo_DeleteReservationCascades(t *testing.T) {
+	repo := newMemoryTestRepo()
+	ctx := context.Background()
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 3)
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{RoomID: 2, StartDate: start, EndDate: end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{RoomID: 2, ReservationID: id, RestrictionID: 1, StartDate: start, EndDate: end})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reservation, err := repo.GetReservationByID(ctx, id)
+	if err != nil || reservation.Room.RoomName != "Major's Suite" {
+		t.Errorf("room not joined: %+v, %v", reservation.Room, err)
+	}
+
+	err = repo.DeleteReservation(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.GetReservationByID(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a deleted reservation, got %v", err)
+	}
+	available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, start, end, 2)
+	if !available {
+		t.Error("room still blocked by the restriction of a deleted reservation")
+	}
+}
+
+func TestMemoryRepo_ForeignKeys(t *testing.T) {
+	repo := newMemoryTestRepo()
+	ctx := context.Background()
+
+	if _, err := repo.InsertReservation(ctx, models.Reservation{RoomID: 3}); err == nil {
+		t.Error("reservation of an unknown room inserted")
+	}
+	if err := repo.InsertRoomRestriction(ctx, models.RoomRestriction{RoomID: 1, ReservationID: 42}); err == nil {
+		t.Error("restriction of an unknown reservation inserted")
+	}
+	if err := repo.InsertExternalRestriction(ctx, models.RoomRestriction{RoomID: 1, FeedID: 42}); err == nil {
+		t.Error("restriction of an unknown feed inserted")
+	}
+}
+
+func TestMemoryRepo_EachReservation(t *testing.T) {
+	repo := newMemoryTestRepo()
+	ctx := context.Background()
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, lastName := range []string{"Smith", "Jones"} {
+		_, err := repo.InsertReservation(ctx, models.Reservation{LastName: lastName, RoomID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// fn may write to the repository without deadlocking
+	var visited int
+	err := repo.EachReservation(ctx, models.ReservationFilter{}, func(reservation models.Reservation) error {
+		visited++
+		return repo.UpdateProcessedForReservation(ctx, reservation.ID, 1)
+	})
+	if err != nil || visited != 2 {
+		t.Fatalf("expected 2 reservations, visited %d: %v", visited, err)
+	}
+
+	unprocessed, _ := repo.AllNewReservations(ctx)
+	if len(unprocessed) != 0 {
+		t.Errorf("expected every reservation to be processed, %d are not", len(unprocessed))
+	}
+}
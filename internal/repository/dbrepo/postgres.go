@@ -3,24 +3,26 @@ package dbrepo
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"fmt"
 	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
+func (m *postgresDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
-func (m *postgresDBRepo) InsertReservation(dto models.Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) InsertReservation(ctx context.Context, dto models.Reservation) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var newID int
 	statement := `insert into reservations (first_name, last_name, email, phone, 
-								start_date, end_date, room_id, created_at, updated_at) 
-								values ($1,$2,$3,$4,$5,$6,$7,$8,$9) returning id`
+								start_date, end_date, room_id, created_at, updated_at, confirmation_code) 
+								values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) returning id`
 
 	err := m.DB.QueryRowContext(ctx, statement,
 		dto.FirstName,
@@ -32,6 +34,7 @@ func (m *postgresDBRepo) InsertReservation(dto models.Reservation) (int, error)
 		dto.RoomID,
 		time.Now(),
 		time.Now(),
+		dto.ConfirmationCode,
 	).Scan(&newID)
 	if err != nil {
 		return 0, err
@@ -40,8 +43,8 @@ func (m *postgresDBRepo) InsertReservation(dto models.Reservation) (int, error)
 	return newID, nil
 }
 
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	statement := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
@@ -64,8 +67,8 @@ func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 	return nil
 }
 
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var numRows int
@@ -84,8 +87,8 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 	return false, nil
 }
 
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var rooms []models.Room
@@ -116,18 +119,19 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 	return rooms, nil
 }
 
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var room models.Room
 
-	query := `select id, room_name, created_at, updated_at from rooms where id = $1`
+	query := `select id, room_name, nightly_rate, created_at, updated_at from rooms where id = $1`
 	row := m.DB.QueryRowContext(ctx, query, id)
 
 	err := row.Scan(
 		&room.ID,
 		&room.RoomName,
+		&room.NightlyRate,
 		&room.CreatedAt,
 		&room.UpdatedAt,
 	)
@@ -138,11 +142,13 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 	return room, nil
 }
 
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at
+	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at,
+						session_version, failed_logins, coalesce(last_failed_login_at, '0001-01-01'),
+						coalesce(locked_until, '0001-01-01'), totp_secret, totp_enabled, totp_last_step, active
 						from users where id = $1`
 	row := m.DB.QueryRowContext(ctx, query, id)
 
@@ -156,6 +162,14 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 		&user.AccessLevel,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.SessionVersion,
+		&user.FailedLogins,
+		&user.LastFailedLoginAt,
+		&user.LockedUntil,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastStep,
+		&user.Active,
 	)
 	if err != nil {
 		return user, err
@@ -164,17 +178,133 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 	return user, nil
 }
 
-func (m *postgresDBRepo) UpdateUser(user models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	query := `update users set first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5`
+	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at,
+						session_version, failed_logins, coalesce(last_failed_login_at, '0001-01-01'),
+						coalesce(locked_until, '0001-01-01'), totp_secret, totp_enabled, totp_last_step, active
+						from users where lower(email) = lower($1)`
+	row := m.DB.QueryRowContext(ctx, query, email)
+
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Password,
+		&user.AccessLevel,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.SessionVersion,
+		&user.FailedLogins,
+		&user.LastFailedLoginAt,
+		&user.LockedUntil,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastStep,
+		&user.Active,
+	)
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+func (m *postgresDBRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var users []models.User
+
+	query := `select id, first_name, last_name, email, access_level, created_at, updated_at, active,
+					totp_enabled, coalesce(locked_until, '0001-01-01')
+					from users
+					order by active desc, last_name, first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return users, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var user models.User
+
+		err := rows.Scan(
+			&user.ID,
+			&user.FirstName,
+			&user.LastName,
+			&user.Email,
+			&user.AccessLevel,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Active,
+			&user.TOTPEnabled,
+			&user.LockedUntil,
+		)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+// InsertUser adds an active user; user.Password must already be hashed
+func (m *postgresDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+
+	statement := `insert into users (first_name, last_name, email, password, access_level, active,
+								created_at, updated_at)
+								values ($1,$2,$3,$4,$5,true,$6,$7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, statement,
+		user.FirstName,
+		user.LastName,
+		user.Email,
+		user.Password,
+		user.AccessLevel,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, user models.User) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update users set first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5
+						where id = $6`
 	_, err := m.DB.ExecContext(ctx, query,
 		user.FirstName,
 		user.LastName,
 		user.Email,
 		user.AccessLevel,
 		time.Now(),
+		user.ID,
 	)
 	if err != nil {
 		return err
@@ -183,31 +313,70 @@ func (m *postgresDBRepo) UpdateUser(user models.User) error {
 	return nil
 }
 
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SetUserActive activates or deactivates a user. Deactivating also ends all sessions of the user.
+func (m *postgresDBRepo) SetUserActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update users set active = $1, updated_at = $2,
+						session_version = session_version + case when $1 then 0 else 1 end
+						where id = $3`
+	_, err := m.DB.ExecContext(ctx, query, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdatePassword sets a new password hash and ends the user's other sessions,
+// returning the session version that remains valid
+func (m *postgresDBRepo) UpdatePassword(ctx context.Context, id int, hashedPassword string) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var sessionVersion int
+
+	query := `update users set password = $1, session_version = session_version + 1, updated_at = $2
+						where id = $3 returning session_version`
+	err := m.DB.QueryRowContext(ctx, query, hashedPassword, time.Now(), id).Scan(&sessionVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	return sessionVersion, nil
+}
+
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var id int
 	var hashedPassword string
-	row := m.DB.QueryRowContext(ctx, "select id,password from users where email = $1", email)
+	var active bool
+	row := m.DB.QueryRowContext(ctx, "select id,password,active from users where lower(email) = lower($1)", email)
 
-	err := row.Scan(&id, &hashedPassword)
+	err := row.Scan(&id, &hashedPassword, &active)
 	if err != nil {
 		return id, "", err
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
 	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return 0, "", errors.New("incorrect password")
+		return 0, "", repository.ErrIncorrectPassword
 	} else if err != nil {
 		return 0, "", err
 	}
 
+	if !active {
+		return 0, "", repository.ErrAccountDeactivated
+	}
+
 	return id, hashedPassword, nil
 }
 
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var reservations []models.Reservation
@@ -260,8 +429,8 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 	return reservations, nil
 }
 
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var reservations []models.Reservation
@@ -314,82 +483,1277 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 	return reservations, nil
 }
 
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern turns user input into a "like" pattern matching it anywhere, with wildcards escaped
+func containsPattern(term string) string {
+	return "%" + likeEscaper.Replace(term) + "%"
+}
+
+// reservationSortColumns maps the sort keys accepted from the admin lists to SQL expressions
+var reservationSortColumns = map[string]string{
+	"id":         "r.id",
+	"last_name":  "r.last_name",
+	"room":       "rm.room_name",
+	"start_date": "r.start_date",
+	"end_date":   "r.end_date",
+	"created_at": "r.created_at",
+}
+
+// ListReservations returns one page of reservations matching query along with the total number of matches
+func (m *postgresDBRepo) ListReservations(ctx context.Context, query models.ReservationQuery) ([]models.Reservation, int, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	var reservation models.Reservation
-	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+	var reservations []models.Reservation
+	var total int
+
+	where, args := reservationFilterClause(query.ReservationFilter)
+
+	countQuery := fmt.Sprintf(`select count(r.id) from reservations r %s`, where)
+	err := m.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	if err != nil {
+		return reservations, 0, err
+	}
+
+	sortColumn, ok := reservationSortColumns[query.Sort]
+	if !ok {
+		sortColumn = reservationSortColumns["start_date"]
+	}
+	direction := "asc"
+	if query.Direction == models.SortDesc {
+		direction = "desc"
+	}
+
+	args = append(args, query.PageSize, query.Offset())
+	listQuery := fmt.Sprintf(`select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
 					r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
 					from reservations r
 					left join rooms rm on (r.room_id = rm.id)
-					where r.id = $1`
+					%s
+					order by %s %s, r.id %s
+					limit $%d offset $%d`, where, sortColumn, direction, direction, len(args)-1, len(args))
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&reservation.ID,
-		&reservation.FirstName,
-		&reservation.LastName,
-		&reservation.Email,
-		&reservation.Phone,
-		&reservation.StartDate,
-		&reservation.EndDate,
-		&reservation.RoomID,
-		&reservation.CreatedAt,
-		&reservation.UpdatedAt,
-		&reservation.Processed,
-		&reservation.Room.ID,
-		&reservation.Room.RoomName,
-	)
+	rows, err := m.DB.QueryContext(ctx, listQuery, args...)
 	if err != nil {
-		return reservation, err
+		return reservations, 0, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var row models.Reservation
+
+		err := rows.Scan(
+			&row.ID,
+			&row.FirstName,
+			&row.LastName,
+			&row.Email,
+			&row.Phone,
+			&row.StartDate,
+			&row.EndDate,
+			&row.RoomID,
+			&row.CreatedAt,
+			&row.UpdatedAt,
+			&row.Processed,
+			&row.Room.ID,
+			&row.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, 0, err
+		}
+
+		reservations = append(reservations, row)
 	}
 
-	return reservation, nil
+	if err = rows.Err(); err != nil {
+		return reservations, 0, err
+	}
+	return reservations, total, nil
 }
 
-func (m *postgresDBRepo) UpdateReservation(reservation models.Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// EachReservation streams reservations matching filter to fn one row at a time,
+// stopping at the first error returned by fn
+func (m *postgresDBRepo) EachReservation(ctx context.Context, filter models.ReservationFilter, fn func(models.Reservation) error) error {
+	where, args := reservationFilterClause(filter)
 
-	query := `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5
-						where id = $6`
-	_, err := m.DB.ExecContext(ctx, query,
-		reservation.FirstName,
-		reservation.LastName,
-		reservation.Email,
-		reservation.Phone,
-		time.Now(),
-		reservation.ID,
-	)
+	query := fmt.Sprintf(`select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+					r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name,
+					coalesce(r.confirmation_code, '')
+					from reservations r
+					left join rooms rm on (r.room_id = rm.id)
+					%s
+					order by r.start_date asc, r.id asc`, where)
+
+	// exports may take longer than a regular query, so only the request's context bounds this one
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
 
-	return nil
+	for rows.Next() {
+		var row models.Reservation
+
+		err := rows.Scan(
+			&row.ID,
+			&row.FirstName,
+			&row.LastName,
+			&row.Email,
+			&row.Phone,
+			&row.StartDate,
+			&row.EndDate,
+			&row.RoomID,
+			&row.CreatedAt,
+			&row.UpdatedAt,
+			&row.Processed,
+			&row.Room.ID,
+			&row.Room.RoomName,
+			&row.ConfirmationCode,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = fn(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
 }
 
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// reservationFilterClause builds a "where" clause and its arguments for the reservations table aliased as r
+func reservationFilterClause(filter models.ReservationFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
 
-	query := `delete from reservations where id = $1`
-	_, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
 	}
 
-	return nil
+	if !filter.StartDate.IsZero() {
+		addCondition("r.end_date >= $%d", filter.StartDate)
+	}
+	if !filter.EndDate.IsZero() {
+		addCondition("r.start_date <= $%d", filter.EndDate)
+	}
+	if filter.RoomID > 0 {
+		addCondition("r.room_id = $%d", filter.RoomID)
+	}
+
+	if filter.Search != "" {
+		addCondition("(r.first_name ilike $%[1]d or r.last_name ilike $%[1]d or r.email ilike $%[1]d)",
+			containsPattern(filter.Search))
+	}
+
+	switch filter.Status {
+	case models.ReservationStatusNew:
+		addCondition("r.processed = $%d", 0)
+	case models.ReservationStatusProcessed:
+		addCondition("r.processed = $%d", 1)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "where " + strings.Join(conditions, " and "), args
 }
 
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SearchReservations finds reservations by confirmation code or by a fuzzy match on
+// guest name, email or phone digits, best matches first
+func (m *postgresDBRepo) SearchReservations(ctx context.Context, term string, limit int) ([]models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	query := `update reservations set processed = $1 where id = $2`
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	var reservations []models.Reservation
+
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return reservations, nil
+	}
+
+	// phone numbers are compared by digits only, and only when enough digits were typed
+	var phoneDigits interface{}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, term)
+	if len(digits) >= 3 {
+		phoneDigits = "%" + digits + "%"
+	}
+
+	pattern := containsPattern(term)
+
+	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+					r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name,
+					coalesce(r.confirmation_code, '')
+					from reservations r
+					left join rooms rm on (r.room_id = rm.id)
+					where r.confirmation_code = upper($1)
+						or (r.first_name || ' ' || r.last_name) ilike $2
+						or r.email ilike $2
+						or (r.first_name || ' ' || r.last_name) % $1
+						or ($3::text is not null and regexp_replace(r.phone, '[^0-9]', '', 'g') like $3)
+					order by (r.confirmation_code = upper($1)) desc,
+						greatest(similarity(r.first_name || ' ' || r.last_name, $1), similarity(r.email, $1)) desc,
+						r.start_date desc
+					limit $4`
+
+	rows, err := m.DB.QueryContext(ctx, query, term, pattern, phoneDigits, limit)
 	if err != nil {
-		return err
+		return reservations, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var row models.Reservation
+
+		err := rows.Scan(
+			&row.ID,
+			&row.FirstName,
+			&row.LastName,
+			&row.Email,
+			&row.Phone,
+			&row.StartDate,
+			&row.EndDate,
+			&row.RoomID,
+			&row.CreatedAt,
+			&row.UpdatedAt,
+			&row.Processed,
+			&row.Room.ID,
+			&row.Room.RoomName,
+			&row.ConfirmationCode,
+		)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+	return reservations, nil
+}
+
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var reservation models.Reservation
+	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+					r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name,
+					coalesce(r.confirmation_code, '')
+					from reservations r
+					left join rooms rm on (r.room_id = rm.id)
+					where r.id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&reservation.ID,
+		&reservation.FirstName,
+		&reservation.LastName,
+		&reservation.Email,
+		&reservation.Phone,
+		&reservation.StartDate,
+		&reservation.EndDate,
+		&reservation.RoomID,
+		&reservation.CreatedAt,
+		&reservation.UpdatedAt,
+		&reservation.Processed,
+		&reservation.Room.ID,
+		&reservation.Room.RoomName,
+		&reservation.ConfirmationCode,
+	)
+	if err != nil {
+		return reservation, err
+	}
+
+	return reservation, nil
+}
+
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, reservation models.Reservation) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5
+						where id = $6`
+	_, err := m.DB.ExecContext(ctx, query,
+		reservation.FirstName,
+		reservation.LastName,
+		reservation.Email,
+		reservation.Phone,
+		time.Now(),
+		reservation.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `delete from reservations where id = $1`
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update reservations set processed = $1 where id = $2`
+	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select id, room_name, nightly_rate, created_at, updated_at from rooms order by room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var room models.Room
+
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+			&room.NightlyRate,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+		)
+		if err != nil {
+			return rooms, err
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+	return rooms, nil
+}
+
+func (m *postgresDBRepo) AllICalFeeds(ctx context.Context) ([]models.RoomICalFeed, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var feeds []models.RoomICalFeed
+
+	query := `select f.id, f.room_id, f.url, coalesce(f.last_synced_at, '0001-01-01'), f.created_at, f.updated_at,
+					rm.id, rm.room_name
+					from room_ical_feeds f
+					left join rooms rm on (f.room_id = rm.id)
+					order by rm.room_name, f.id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return feeds, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var feed models.RoomICalFeed
+
+		err := rows.Scan(
+			&feed.ID,
+			&feed.RoomID,
+			&feed.URL,
+			&feed.LastSyncedAt,
+			&feed.CreatedAt,
+			&feed.UpdatedAt,
+			&feed.Room.ID,
+			&feed.Room.RoomName,
+		)
+		if err != nil {
+			return feeds, err
+		}
+
+		feeds = append(feeds, feed)
+	}
+
+	if err = rows.Err(); err != nil {
+		return feeds, err
+	}
+	return feeds, nil
+}
+
+func (m *postgresDBRepo) GetICalFeedByID(ctx context.Context, id int) (models.RoomICalFeed, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var feed models.RoomICalFeed
+
+	query := `select f.id, f.room_id, f.url, coalesce(f.last_synced_at, '0001-01-01'), f.created_at, f.updated_at,
+					rm.id, rm.room_name
+					from room_ical_feeds f
+					left join rooms rm on (f.room_id = rm.id)
+					where f.id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&feed.ID,
+		&feed.RoomID,
+		&feed.URL,
+		&feed.LastSyncedAt,
+		&feed.CreatedAt,
+		&feed.UpdatedAt,
+		&feed.Room.ID,
+		&feed.Room.RoomName,
+	)
+	if err != nil {
+		return feed, err
+	}
+
+	return feed, nil
+}
+
+func (m *postgresDBRepo) InsertICalFeed(ctx context.Context, feed models.RoomICalFeed) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+	statement := `insert into room_ical_feeds (room_id, url, created_at, updated_at)
+								values ($1,$2,$3,$4) returning id`
+
+	err := m.DB.QueryRowContext(ctx, statement,
+		feed.RoomID,
+		feed.URL,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *postgresDBRepo) DeleteICalFeed(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `delete from room_ical_feeds where id = $1`
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) UpdateICalFeedSyncedAt(ctx context.Context, id int, syncedAt time.Time) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update room_ical_feeds set last_synced_at = $1, updated_at = $2 where id = $3`
+	_, err := m.DB.ExecContext(ctx, query, syncedAt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) ExternalRestrictionsByFeedID(ctx context.Context, feedID int) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `select id, start_date, end_date, room_id, restriction_id, feed_id, external_uid, created_at, updated_at
+					from room_restrictions
+					where feed_id = $1 and restriction_id = $2`
+
+	rows, err := m.DB.QueryContext(ctx, query, feedID, models.RestrictionExternal)
+	if err != nil {
+		return restrictions, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var row models.RoomRestriction
+
+		err := rows.Scan(
+			&row.ID,
+			&row.StartDate,
+			&row.EndDate,
+			&row.RoomID,
+			&row.RestrictionID,
+			&row.FeedID,
+			&row.ExternalUID,
+			&row.CreatedAt,
+			&row.UpdatedAt,
+		)
+		if err != nil {
+			return restrictions, err
+		}
+
+		restrictions = append(restrictions, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+	return restrictions, nil
+}
+
+func (m *postgresDBRepo) InsertExternalRestriction(ctx context.Context, r models.RoomRestriction) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	statement := `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
+								feed_id, external_uid, created_at, updated_at)
+								values ($1,$2,$3,$4,$5,$6,$7,$8)`
+
+	_, err := m.DB.ExecContext(ctx, statement,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		models.RestrictionExternal,
+		r.FeedID,
+		r.ExternalUID,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) UpdateRoomRestrictionDates(ctx context.Context, id int, start, end time.Time) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update room_restrictions set start_date = $1, end_date = $2, updated_at = $3 where id = $4`
+	_, err := m.DB.ExecContext(ctx, query, start, end, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) DeleteRoomRestriction(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `delete from room_restrictions where id = $1`
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) InsertICalSyncLog(ctx context.Context, log models.ICalSyncLog) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	statement := `insert into ical_sync_logs (feed_id, status, message, added, updated, removed,
+								created_at, updated_at)
+								values ($1,$2,$3,$4,$5,$6,$7,$8)`
+
+	_, err := m.DB.ExecContext(ctx, statement,
+		log.FeedID,
+		log.Status,
+		log.Message,
+		log.Added,
+		log.Updated,
+		log.Removed,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) ICalSyncLogsByFeedID(ctx context.Context, feedID, limit int) ([]models.ICalSyncLog, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var logs []models.ICalSyncLog
+
+	query := `select id, feed_id, status, message, added, updated, removed, created_at, updated_at
+					from ical_sync_logs
+					where feed_id = $1
+					order by created_at desc
+					limit $2`
+
+	rows, err := m.DB.QueryContext(ctx, query, feedID, limit)
+	if err != nil {
+		return logs, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var row models.ICalSyncLog
+
+		err := rows.Scan(
+			&row.ID,
+			&row.FeedID,
+			&row.Status,
+			&row.Message,
+			&row.Added,
+			&row.Updated,
+			&row.Removed,
+			&row.CreatedAt,
+			&row.UpdatedAt,
+		)
+		if err != nil {
+			return logs, err
+		}
+
+		logs = append(logs, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return logs, err
+	}
+	return logs, nil
+}
+
+// DashboardStats counts today's arrivals, departures, occupied rooms and unprocessed reservations
+func (m *postgresDBRepo) DashboardStats(ctx context.Context, day time.Time) (models.DashboardStats, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var stats models.DashboardStats
+
+	query := `select
+					(select count(id) from reservations where start_date = $1),
+					(select count(id) from reservations where end_date = $1),
+					(select count(distinct room_id) from room_restrictions where start_date <= $1 and end_date > $1),
+					(select count(id) from rooms),
+					(select count(id) from reservations where processed = 0)`
+
+	err := m.DB.QueryRowContext(ctx, query, day).Scan(
+		&stats.ArrivalsToday,
+		&stats.DeparturesToday,
+		&stats.OccupiedRooms,
+		&stats.TotalRooms,
+		&stats.Unprocessed,
+	)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// ReservationsArrivingOrDeparting returns reservations starting or ending on day
+func (m *postgresDBRepo) ReservationsArrivingOrDeparting(ctx context.Context, day time.Time) ([]models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+					r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+					from reservations r
+					left join rooms rm on (r.room_id = rm.id)
+					where r.start_date = $1 or r.end_date = $1
+					order by rm.room_name, r.last_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, day)
+	if err != nil {
+		return reservations, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var row models.Reservation
+
+		err := rows.Scan(
+			&row.ID,
+			&row.FirstName,
+			&row.LastName,
+			&row.Email,
+			&row.Phone,
+			&row.StartDate,
+			&row.EndDate,
+			&row.RoomID,
+			&row.CreatedAt,
+			&row.UpdatedAt,
+			&row.Processed,
+			&row.Room.ID,
+			&row.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+	return reservations, nil
+}
+
+// RoomOccupancy returns, for every room, how many nights between start and end are blocked
+func (m *postgresDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var occupancy []models.RoomOccupancy
+
+	// a night blocked by overlapping restrictions (e.g. a reservation and an external block) counts once
+	query := `select rm.id, rm.room_name, count(distinct n.night)
+					from rooms rm
+					left join room_restrictions rr on (rr.room_id = rm.id and rr.start_date < $2 and rr.end_date > $1)
+					left join lateral generate_series(greatest(rr.start_date, $1::date),
+						least(rr.end_date, $2::date) - 1, interval '1 day') as n(night) on true
+					group by rm.id, rm.room_name
+					order by rm.room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return occupancy, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	nights := int(end.Sub(start).Hours() / 24)
+	for rows.Next() {
+		row := models.RoomOccupancy{Nights: nights}
+
+		err := rows.Scan(
+			&row.Room.ID,
+			&row.Room.RoomName,
+			&row.BookedNights,
+		)
+		if err != nil {
+			return occupancy, err
+		}
+
+		occupancy = append(occupancy, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return occupancy, err
+	}
+	return occupancy, nil
+}
+
+// MonthlyRevenue sums nights times room rate for reservations arriving between start and end, per month.
+// Months without reservations are included with zero revenue.
+func (m *postgresDBRepo) MonthlyRevenue(ctx context.Context, start, end time.Time) ([]models.MonthlyRevenue, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var revenue []models.MonthlyRevenue
+
+	query := `select months.month, coalesce(sum((r.end_date - r.start_date) * rm.nightly_rate), 0)
+					from generate_series(date_trunc('month', $1::date), date_trunc('month', $2::date) - interval '1 day',
+						interval '1 month') as months(month)
+					left join reservations r on (date_trunc('month', r.start_date) = months.month)
+					left join rooms rm on (r.room_id = rm.id)
+					group by months.month
+					order by months.month`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return revenue, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var row models.MonthlyRevenue
+
+		err := rows.Scan(
+			&row.Month,
+			&row.Revenue,
+		)
+		if err != nil {
+			return revenue, err
+		}
+
+		revenue = append(revenue, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return revenue, err
+	}
+	return revenue, nil
+}
+
+func (m *postgresDBRepo) InsertPasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	statement := `insert into password_reset_tokens (user_id, token_hash, expires_at, created_at, updated_at)
+								values ($1,$2,$3,$4,$5)`
+
+	_, err := m.DB.ExecContext(ctx, statement,
+		userID,
+		tokenHash,
+		expiresAt,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PasswordResetTokenUserID returns the user a reset token belongs to, if it is unused and not expired
+func (m *postgresDBRepo) PasswordResetTokenUserID(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var userID int
+	query := `select user_id from password_reset_tokens
+						where token_hash = $1 and used_at is null and expires_at > $2`
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ResetPassword uses up a reset token, stores the new password hash and invalidates the user's
+// other reset tokens and sessions. It returns the id of the user whose password was changed.
+func (m *postgresDBRepo) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var userID int
+	query := `update password_reset_tokens set used_at = $1, updated_at = $1
+						where token_hash = $2 and used_at is null and expires_at > $1
+						returning user_id`
+	err = tx.QueryRowContext(ctx, query, time.Now(), tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, repository.ErrInvalidResetToken
+	} else if err != nil {
+		return 0, err
+	}
+
+	query = `update password_reset_tokens set used_at = $1, updated_at = $1
+						where user_id = $2 and used_at is null`
+	_, err = tx.ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `update users set password = $1, session_version = session_version + 1, updated_at = $2,
+						failed_logins = 0, last_failed_login_at = null, locked_until = null
+						where id = $3`
+	_, err = tx.ExecContext(ctx, query, hashedPassword, time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// nullableTime maps the zero time to NULL
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// RecordFailedLogin counts one more failed login for the user and locks the account
+// until lockedUntil, unless it is the zero time
+func (m *postgresDBRepo) RecordFailedLogin(ctx context.Context, userID int, lockedUntil time.Time) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update users set failed_logins = failed_logins + 1, last_failed_login_at = $1,
+						locked_until = coalesce($2::timestamp, locked_until)
+						where id = $3`
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), nullableTime(lockedUntil), userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetFailedLogins clears the failure count and any lock, after a successful login or an admin unlock
+func (m *postgresDBRepo) ResetFailedLogins(ctx context.Context, userID int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update users set failed_logins = 0, last_failed_login_at = null, locked_until = null
+						where id = $1`
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgresDBRepo) LockedUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var users []models.User
+
+	query := `select id, first_name, last_name, email, failed_logins, coalesce(last_failed_login_at, '0001-01-01'), locked_until
+					from users
+					where locked_until > $1
+					order by locked_until desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return users, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var user models.User
+
+		err := rows.Scan(
+			&user.ID,
+			&user.FirstName,
+			&user.LastName,
+			&user.Email,
+			&user.FailedLogins,
+			&user.LastFailedLoginAt,
+			&user.LockedUntil,
+		)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+func (m *postgresDBRepo) InsertLoginEvent(ctx context.Context, event models.LoginEvent) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var userID interface{}
+	if event.UserID > 0 {
+		userID = event.UserID
+	}
+
+	statement := `insert into login_events (user_id, email, ip_address, success, created_at, updated_at)
+								values ($1,$2,$3,$4,$5,$6)`
+
+	_, err := m.DB.ExecContext(ctx, statement,
+		userID,
+		event.Email,
+		event.IPAddress,
+		event.Success,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FailedLoginsByIP returns how many failed logins came from ip since the given time, and when the last one was
+func (m *postgresDBRepo) FailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var count int
+	var last time.Time
+
+	query := `select count(*), coalesce(max(created_at), '0001-01-01')
+					from login_events
+					where ip_address = $1 and not success and created_at > $2`
+
+	err := m.DB.QueryRowContext(ctx, query, ip, since).Scan(&count, &last)
+	if err != nil {
+		return 0, last, err
+	}
+
+	return count, last, nil
+}
+
+func (m *postgresDBRepo) RecentLoginEvents(ctx context.Context, limit int) ([]models.LoginEvent, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var events []models.LoginEvent
+
+	query := `select id, coalesce(user_id, 0), email, ip_address, success, created_at, updated_at
+					from login_events
+					order by created_at desc
+					limit $1`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return events, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var event models.LoginEvent
+
+		err := rows.Scan(
+			&event.ID,
+			&event.UserID,
+			&event.Email,
+			&event.IPAddress,
+			&event.Success,
+			&event.CreatedAt,
+			&event.UpdatedAt,
+		)
+		if err != nil {
+			return events, err
+		}
+
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return events, err
+	}
+
+	return events, nil
+}
+
+// SetTOTPSecret stores the secret of a two-factor enrollment that has not been confirmed yet
+func (m *postgresDBRepo) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update users set totp_secret = $1, totp_enabled = false, updated_at = $2 where id = $3`
+	_, err := m.DB.ExecContext(ctx, query, secret, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EnableTOTP turns on two-factor login with the stored secret and replaces the user's recovery codes
+func (m *postgresDBRepo) EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `update users set totp_enabled = true, totp_last_step = $1, updated_at = $2
+						where id = $3 and totp_secret <> ''`
+	result, err := tx.ExecContext(ctx, query, step, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return repository.ErrTOTPNotStarted
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		statement := `insert into recovery_codes (user_id, code_hash, created_at, updated_at)
+									values ($1,$2,$3,$4)`
+		_, err = tx.ExecContext(ctx, statement, userID, hash, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *postgresDBRepo) DisableTOTP(ctx context.Context, userID int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `update users set totp_secret = '', totp_enabled = false, totp_last_step = 0, updated_at = $1
+						where id = $2`
+	_, err = tx.ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateTOTPLastStep records the time step of a used code. It fails if that step, or a later one,
+// was already used, so the same code cannot log in twice even with concurrent requests.
+func (m *postgresDBRepo) UpdateTOTPLastStep(ctx context.Context, userID int, step int64) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update users set totp_last_step = $1 where id = $2 and totp_last_step < $1`
+	result, err := m.DB.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrCodeAlreadyUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used, failing if there is none
+func (m *postgresDBRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update recovery_codes set used_at = $1, updated_at = $1
+						where user_id = $2 and code_hash = $3 and used_at is null`
+	result, err := m.DB.ExecContext(ctx, query, time.Now(), userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrInvalidRecoveryCode
 	}
 
 	return nil
@@ -1,40 +1,56 @@
 package dbrepo
 
 import (
+	"context"
 	"errors"
 	"github.com/Sunpacker/go-booking-app/internal/models"
+	"github.com/Sunpacker/go-booking-app/internal/repository"
 	"time"
 )
 
-func (m *testDBRepo) AllUsers() bool {
+// testInvalidTokenHash is the sha256 hex digest of the reset token "invalid"
+const testInvalidTokenHash = "f1234d75178d892a133a410355a5a990cf75d2f33eba25d575943d4df632f3a4"
+
+// testTwoFactorEmail belongs to testTwoFactorUserID, who has two-factor login enabled with testTOTPSecret
+const testTwoFactorEmail = "twofactor@here.com"
+const testTwoFactorUserID = 2
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// testRecoveryCodeHash is the sha256 hex digest of the recovery code "abcde-fghjk"
+const testRecoveryCodeHash = "f43fe8875771ca2cb43a28612878e3569ceac3b56c1d88bd558122e69097db18"
+
+// testThrottledIP has too many recent failed logins to be allowed another attempt
+const testThrottledIP = "10.0.0.66"
+
+func (m *testDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
-func (m *testDBRepo) InsertReservation(dto models.Reservation) (int, error) {
+func (m *testDBRepo) InsertReservation(ctx context.Context, dto models.Reservation) (int, error) {
 	_ = dto
 	return 1, nil
 }
 
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+func (m *testDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
 	_ = r
 	return nil
 }
 
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
 	_ = start
 	_ = end
 	_ = roomID
 	return false, nil
 }
 
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+func (m *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
 	var rooms []models.Room
 	_ = start
 	_ = end
 	return rooms, nil
 }
 
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+func (m *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
 	var room models.Room
 
 	if id > 2 {
@@ -43,44 +59,273 @@ func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
 	return room, nil
 }
 
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
-	_ = id
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	var user models.User
+
+	if id == testTwoFactorUserID {
+		user.ID = id
+		user.Email = testTwoFactorEmail
+		user.Active = true
+		user.TOTPSecret = testTOTPSecret
+		user.TOTPEnabled = true
+	}
+	return user, nil
+}
+func (m *testDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 	var user models.User
+
+	if email == "missing@here.com" {
+		return user, errors.New("no such user")
+	}
+	user.ID = 1
+	user.Email = email
+	user.Active = true
+
+	switch email {
+	case "locked@here.com":
+		user.FailedLogins = 10
+		user.LastFailedLoginAt = time.Now()
+		user.LockedUntil = time.Now().Add(time.Hour)
+	case "throttled@here.com":
+		user.FailedLogins = 8
+		user.LastFailedLoginAt = time.Now()
+	case testTwoFactorEmail:
+		return m.GetUserByID(ctx, testTwoFactorUserID)
+	}
 	return user, nil
 }
-func (m *testDBRepo) UpdateUser(user models.User) error {
+func (m *testDBRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	return users, nil
+}
+func (m *testDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	if user.Email == "fail@insert.com" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+func (m *testDBRepo) UpdateUser(ctx context.Context, user models.User) error {
 	_ = user
 	return nil
 }
-func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	_ = email
-	_ = testPassword
+func (m *testDBRepo) SetUserActive(ctx context.Context, id int, active bool) error {
+	_ = id
+	_ = active
+	return nil
+}
+func (m *testDBRepo) UpdatePassword(ctx context.Context, id int, hashedPassword string) (int, error) {
+	_ = id
+	_ = hashedPassword
+	return 1, nil
+}
+func (m *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	if testPassword == "wrong" {
+		return 0, "", repository.ErrIncorrectPassword
+	}
+	if email == testTwoFactorEmail {
+		return testTwoFactorUserID, "", nil
+	}
 	return 0, "", nil
 }
 
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) InsertPasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_ = userID
+	_ = tokenHash
+	_ = expiresAt
+	return nil
+}
+func (m *testDBRepo) PasswordResetTokenUserID(ctx context.Context, tokenHash string) (int, error) {
+	if tokenHash == testInvalidTokenHash {
+		return 0, repository.ErrInvalidResetToken
+	}
+	return 1, nil
+}
+func (m *testDBRepo) RecordFailedLogin(ctx context.Context, userID int, lockedUntil time.Time) error {
+	_ = userID
+	_ = lockedUntil
+	return nil
+}
+func (m *testDBRepo) ResetFailedLogins(ctx context.Context, userID int) error {
+	_ = userID
+	return nil
+}
+func (m *testDBRepo) LockedUsers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	return users, nil
+}
+func (m *testDBRepo) InsertLoginEvent(ctx context.Context, event models.LoginEvent) error {
+	_ = event
+	return nil
+}
+func (m *testDBRepo) FailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error) {
+	_ = since
+	if ip == testThrottledIP {
+		return 100, time.Now(), nil
+	}
+	return 0, time.Time{}, nil
+}
+func (m *testDBRepo) RecentLoginEvents(ctx context.Context, limit int) ([]models.LoginEvent, error) {
+	_ = limit
+	var events []models.LoginEvent
+	return events, nil
+}
+func (m *testDBRepo) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	_ = userID
+	_ = secret
+	return nil
+}
+func (m *testDBRepo) EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	_ = userID
+	_ = step
+	_ = recoveryCodeHashes
+	return nil
+}
+func (m *testDBRepo) DisableTOTP(ctx context.Context, userID int) error {
+	_ = userID
+	return nil
+}
+func (m *testDBRepo) UpdateTOTPLastStep(ctx context.Context, userID int, step int64) error {
+	_ = userID
+	_ = step
+	return nil
+}
+func (m *testDBRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	_ = userID
+	if codeHash != testRecoveryCodeHash {
+		return repository.ErrInvalidRecoveryCode
+	}
+	return nil
+}
+func (m *testDBRepo) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (int, error) {
+	_ = hashedPassword
+	if tokenHash == testInvalidTokenHash {
+		return 0, repository.ErrInvalidResetToken
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
 	var reservations []models.Reservation
 	return reservations, nil
 }
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+func (m *testDBRepo) ListReservations(ctx context.Context, query models.ReservationQuery) ([]models.Reservation, int, error) {
+	_ = query
+	var reservations []models.Reservation
+	return reservations, 0, nil
+}
+func (m *testDBRepo) SearchReservations(ctx context.Context, term string, limit int) ([]models.Reservation, error) {
+	_ = term
+	_ = limit
 	var reservations []models.Reservation
 	return reservations, nil
 }
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+func (m *testDBRepo) EachReservation(ctx context.Context, filter models.ReservationFilter, fn func(models.Reservation) error) error {
+	_ = filter
+	_ = fn
+	return nil
+}
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
 	_ = id
 	var reservation models.Reservation
 	return reservation, nil
 }
-func (m *testDBRepo) UpdateReservation(reservation models.Reservation) error {
+func (m *testDBRepo) UpdateReservation(ctx context.Context, reservation models.Reservation) error {
 	_ = reservation
 	return nil
 }
-func (m *testDBRepo) DeleteReservation(id int) error {
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
 	_ = id
 	return nil
 }
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+func (m *testDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
 	_ = id
 	_ = processed
 	return nil
 }
+
+func (m *testDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	var rooms []models.Room
+	return rooms, nil
+}
+
+func (m *testDBRepo) DashboardStats(ctx context.Context, day time.Time) (models.DashboardStats, error) {
+	_ = day
+	var stats models.DashboardStats
+	return stats, nil
+}
+func (m *testDBRepo) ReservationsArrivingOrDeparting(ctx context.Context, day time.Time) ([]models.Reservation, error) {
+	_ = day
+	var reservations []models.Reservation
+	return reservations, nil
+}
+func (m *testDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	_ = start
+	_ = end
+	var occupancy []models.RoomOccupancy
+	return occupancy, nil
+}
+func (m *testDBRepo) MonthlyRevenue(ctx context.Context, start, end time.Time) ([]models.MonthlyRevenue, error) {
+	_ = start
+	_ = end
+	var revenue []models.MonthlyRevenue
+	return revenue, nil
+}
+
+func (m *testDBRepo) AllICalFeeds(ctx context.Context) ([]models.RoomICalFeed, error) {
+	var feeds []models.RoomICalFeed
+	return feeds, nil
+}
+func (m *testDBRepo) GetICalFeedByID(ctx context.Context, id int) (models.RoomICalFeed, error) {
+	var feed models.RoomICalFeed
+
+	if id > 2 {
+		return feed, errors.New("some error")
+	}
+	return feed, nil
+}
+func (m *testDBRepo) InsertICalFeed(ctx context.Context, feed models.RoomICalFeed) (int, error) {
+	_ = feed
+	return 1, nil
+}
+func (m *testDBRepo) DeleteICalFeed(ctx context.Context, id int) error {
+	_ = id
+	return nil
+}
+func (m *testDBRepo) UpdateICalFeedSyncedAt(ctx context.Context, id int, syncedAt time.Time) error {
+	_ = id
+	_ = syncedAt
+	return nil
+}
+func (m *testDBRepo) ExternalRestrictionsByFeedID(ctx context.Context, feedID int) ([]models.RoomRestriction, error) {
+	_ = feedID
+	var restrictions []models.RoomRestriction
+	return restrictions, nil
+}
+func (m *testDBRepo) InsertExternalRestriction(ctx context.Context, r models.RoomRestriction) error {
+	_ = r
+	return nil
+}
+func (m *testDBRepo) UpdateRoomRestrictionDates(ctx context.Context, id int, start, end time.Time) error {
+	_ = id
+	_ = start
+	_ = end
+	return nil
+}
+func (m *testDBRepo) DeleteRoomRestriction(ctx context.Context, id int) error {
+	_ = id
+	return nil
+}
+func (m *testDBRepo) InsertICalSyncLog(ctx context.Context, log models.ICalSyncLog) error {
+	_ = log
+	return nil
+}
+func (m *testDBRepo) ICalSyncLogsByFeedID(ctx context.Context, feedID, limit int) ([]models.ICalSyncLog, error) {
+	_ = feedID
+	_ = limit
+	var logs []models.ICalSyncLog
+	return logs, nil
+}
@@ -1,26 +1,79 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"github.com/Sunpacker/go-booking-app/internal/models"
 	"time"
 )
 
+// Errors every DatabaseRepo returns for the same expected failures. Looking up a row that does not
+// exist returns sql.ErrNoRows.
+var (
+	ErrIncorrectPassword   = errors.New("incorrect password")
+	ErrAccountDeactivated  = errors.New("account is deactivated")
+	ErrInvalidResetToken   = errors.New("invalid or expired reset token")
+	ErrTOTPNotStarted      = errors.New("two-factor enrollment was not started")
+	ErrCodeAlreadyUsed     = errors.New("authentication code already used")
+	ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+)
+
 type DatabaseRepo interface {
-	AllUsers() bool
-	InsertReservation(dto models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
+	AllUsers(ctx context.Context) bool
+	InsertReservation(ctx context.Context, dto models.Reservation) (int, error)
+	InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+	AllRooms(ctx context.Context) ([]models.Room, error)
+
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	InsertUser(ctx context.Context, user models.User) (int, error)
+	UpdateUser(ctx context.Context, user models.User) error
+	SetUserActive(ctx context.Context, id int, active bool) error
+	UpdatePassword(ctx context.Context, id int, hashedPassword string) (int, error)
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+	InsertPasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	PasswordResetTokenUserID(ctx context.Context, tokenHash string) (int, error)
+	ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (int, error)
+	RecordFailedLogin(ctx context.Context, userID int, lockedUntil time.Time) error
+	ResetFailedLogins(ctx context.Context, userID int) error
+	LockedUsers(ctx context.Context) ([]models.User, error)
+	InsertLoginEvent(ctx context.Context, event models.LoginEvent) error
+	FailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error)
+	RecentLoginEvents(ctx context.Context, limit int) ([]models.LoginEvent, error)
+	SetTOTPSecret(ctx context.Context, userID int, secret string) error
+	EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID int) error
+	UpdateTOTPLastStep(ctx context.Context, userID int, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+
+	AllReservations(ctx context.Context) ([]models.Reservation, error)
+	AllNewReservations(ctx context.Context) ([]models.Reservation, error)
+	ListReservations(ctx context.Context, query models.ReservationQuery) ([]models.Reservation, int, error)
+	SearchReservations(ctx context.Context, term string, limit int) ([]models.Reservation, error)
+	EachReservation(ctx context.Context, filter models.ReservationFilter, fn func(models.Reservation) error) error
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, reservation models.Reservation) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
 
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(user models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
+	DashboardStats(ctx context.Context, day time.Time) (models.DashboardStats, error)
+	ReservationsArrivingOrDeparting(ctx context.Context, day time.Time) ([]models.Reservation, error)
+	RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error)
+	MonthlyRevenue(ctx context.Context, start, end time.Time) ([]models.MonthlyRevenue, error)
 
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(reservation models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
+	AllICalFeeds(ctx context.Context) ([]models.RoomICalFeed, error)
+	GetICalFeedByID(ctx context.Context, id int) (models.RoomICalFeed, error)
+	InsertICalFeed(ctx context.Context, feed models.RoomICalFeed) (int, error)
+	DeleteICalFeed(ctx context.Context, id int) error
+	UpdateICalFeedSyncedAt(ctx context.Context, id int, syncedAt time.Time) error
+	ExternalRestrictionsByFeedID(ctx context.Context, feedID int) ([]models.RoomRestriction, error)
+	InsertExternalRestriction(ctx context.Context, r models.RoomRestriction) error
+	UpdateRoomRestrictionDates(ctx context.Context, id int, start, end time.Time) error
+	DeleteRoomRestriction(ctx context.Context, id int) error
+	InsertICalSyncLog(ctx context.Context, log models.ICalSyncLog) error
+	ICalSyncLogsByFeedID(ctx context.Context, feedID, limit int) ([]models.ICalSyncLog, error)
 }
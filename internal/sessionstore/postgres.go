@@ -0,0 +1,146 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// PostgresStore keeps scs sessions in the sessions table, so logins survive restarts
+// and are shared between instances of the app
+type PostgresStore struct {
+	db          *sql.DB
+	stopCleanup chan bool
+}
+
+// NewPostgresStore returns a store using db. Expired sessions are deleted every cleanupInterval;
+// an interval of zero disables the cleanup.
+func NewPostgresStore(db *sql.DB, cleanupInterval time.Duration) *PostgresStore {
+	p := &PostgresStore{db: db}
+	if cleanupInterval > 0 {
+		p.stopCleanup = make(chan bool)
+		go p.startCleanup(cleanupInterval)
+	}
+	return p
+}
+
+// Find returns the data of an unexpired session. A missing or expired token is not an error.
+func (p *PostgresStore) Find(token string) ([]byte, bool, error) {
+	return p.FindCtx(context.Background(), token)
+}
+
+func (p *PostgresStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	var b []byte
+
+	query := `select data from sessions where token = $1 and expiry > current_timestamp`
+	err := p.db.QueryRowContext(ctx, query, token).Scan(&b)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit adds a session or replaces its data and expiry
+func (p *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	return p.CommitCtx(context.Background(), token, b, expiry)
+}
+
+func (p *PostgresStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	statement := `insert into sessions (token, data, expiry) values ($1, $2, $3)
+								on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`
+
+	_, err := p.db.ExecContext(ctx, statement, token, b, expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes a session; deleting a missing token is a no-op
+func (p *PostgresStore) Delete(token string) error {
+	return p.DeleteCtx(context.Background(), token)
+}
+
+func (p *PostgresStore) DeleteCtx(ctx context.Context, token string) error {
+	_, err := p.db.ExecContext(ctx, `delete from sessions where token = $1`, token)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// All returns the data of every unexpired session, keyed by token
+func (p *PostgresStore) All() (map[string][]byte, error) {
+	return p.AllCtx(context.Background())
+}
+
+func (p *PostgresStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	sessions := make(map[string][]byte)
+
+	rows, err := p.db.QueryContext(ctx, `select token, data from sessions where expiry > current_timestamp`)
+	if err != nil {
+		return sessions, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var token string
+		var b []byte
+
+		err := rows.Scan(&token, &b)
+		if err != nil {
+			return sessions, err
+		}
+
+		sessions[token] = b
+	}
+
+	if err = rows.Err(); err != nil {
+		return sessions, err
+	}
+
+	return sessions, nil
+}
+
+// StopCleanup ends the background cleanup, e.g. before closing the database in tests
+func (p *PostgresStore) StopCleanup() {
+	if p.stopCleanup != nil {
+		p.stopCleanup <- true
+	}
+}
+
+func (p *PostgresStore) startCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := p.deleteExpired()
+			if err != nil {
+				slog.Error("cannot delete expired sessions", slog.String("error", err.Error()))
+			}
+		case <-p.stopCleanup:
+			return
+		}
+	}
+}
+
+func (p *PostgresStore) deleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `delete from sessions where expiry < current_timestamp`)
+	return err
+}
@@ -0,0 +1,71 @@
+package sessionstore
+
+import (
+	"bytes"
+	"database/sql"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"os"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to the migrated database in TEST_DATABASE_DSN, skipping the test without one
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestPostgresStore(t *testing.T) {
+	store := NewPostgresStore(openTestDB(t), 0)
+	token := "test-token-" + time.Now().Format("150405.000000")
+
+	err := store.Commit(token, []byte("first"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Commit(token, []byte("second"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, found, err := store.Find(token)
+	if err != nil || !found || !bytes.Equal(b, []byte("second")) {
+		t.Errorf("expected updated session, got %q found=%t err=%v", b, found, err)
+	}
+
+	all, err := store.All()
+	if err != nil || !bytes.Equal(all[token], []byte("second")) {
+		t.Errorf("session missing from All: %v", err)
+	}
+
+	err = store.Delete(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Find(token); found {
+		t.Error("deleted session still found")
+	}
+
+	err = store.Commit(token, []byte("expired"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Find(token); found {
+		t.Error("expired session found")
+	}
+	err = store.deleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
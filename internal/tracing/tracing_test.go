@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useMemoryExporter routes spans into an in-memory exporter until the test ends
+func useMemoryExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(sdktrace.WithSyncer(exporter))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+
+	return exporter
+}
+
+func spanNamed(spans tracetest.SpanStubs, name string) (tracetest.SpanStub, bool) {
+	for _, span := range spans {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
+
+func TestMiddleware(t *testing.T) {
+	exporter := useMemoryExporter(t)
+
+	mux := chi.NewRouter()
+	mux.Use(Middleware)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "DatabaseRepo.GetRoomByID")
+		End(span, nil)
+	})
+	mux.Get("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/rooms/1", nil))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/broken", nil))
+
+	spans := exporter.GetSpans()
+	request, ok := spanNamed(spans, "GET /rooms/{id}")
+	if !ok {
+		t.Fatalf("request span not named by its route: %v", spans)
+	}
+	query, ok := spanNamed(spans, "DatabaseRepo.GetRoomByID")
+	if !ok {
+		t.Fatal("missing span of the repository call")
+	}
+	if query.Parent.SpanID() != request.SpanContext.SpanID() || query.SpanContext.TraceID() != request.SpanContext.TraceID() {
+		t.Error("repository span is not a child of the request span")
+	}
+
+	found := false
+	for _, attr := range request.Attributes {
+		if attr == semconv.HTTPResponseStatusCode(http.StatusOK) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("status code not recorded: %v", request.Attributes)
+	}
+
+	broken, ok := spanNamed(spans, "GET /broken")
+	if !ok || broken.Status.Code != codes.Error {
+		t.Errorf("500 response not marked as an error: %+v", broken.Status)
+	}
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	exporter := useMemoryExporter(t)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	if spans[0].SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace of the caller not continued: %s", spans[0].SpanContext.TraceID())
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "none")
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Errorf("tracing could not be turned off: %v", err)
+	}
+
+	_, err = Setup(context.Background(), "zipkin")
+	if err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}
@@ -0,0 +1 @@
+delete from restrictions where id = 2
\ No newline at end of file
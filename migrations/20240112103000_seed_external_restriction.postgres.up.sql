@@ -0,0 +1 @@
+INSERT INTO "public"."restrictions" ("id", "restriction_name", "created_at", "updated_at") VALUES (2, 'external', '2024-01-12 10:30:00', '2024-01-12 10:30:00');
\ No newline at end of file
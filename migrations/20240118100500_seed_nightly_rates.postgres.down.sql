@@ -0,0 +1 @@
+UPDATE "public"."rooms" SET "nightly_rate" = 0 WHERE "id" in (1, 2)
\ No newline at end of file
@@ -0,0 +1,2 @@
+UPDATE "public"."rooms" SET "nightly_rate" = 9900 WHERE "id" = 1;
+UPDATE "public"."rooms" SET "nightly_rate" = 14900 WHERE "id" = 2;